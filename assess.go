@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	grob "github.com/MetalBlueberry/go-plotly/graph_objects"
@@ -13,7 +15,11 @@ import (
 )
 
 // assessModel drives the model assessment based on the user specs in the .gom file.
-func assessModel(specs specsMap, conn *chutils.Connect, log *os.File) error {
+//
+// The model is run once on the assess data.  The curves and assessments are then run in parallel, up to
+// assessWorkers at a time.  They share the assess data and the fitted values, which they only read.  If the run is
+// interrupted, the curves and assessments under way are finished.
+func assessModel(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
 	var (
 		fts        sea.FTypes
 		assessPipe sea.Pipeline
@@ -21,7 +27,7 @@ func assessModel(specs specsMap, conn *chutils.Connect, log *os.File) error {
 	)
 
 	start := time.Now()
-	logger(log, fmt.Sprintf("starting assessment @ %s", start.Format(time.UnixDate)), true)
+	log.start("assessment", start)
 
 	if fts, e = sea.LoadFTypes(specs.getVal("modelDir", true) + "fieldDefs.jsn"); e != nil {
 		return e
@@ -34,34 +40,78 @@ func assessModel(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
-	logger(log, fmt.Sprintf("\n\n%v", assessPipe), false)
+	log.debug("pipeline", fmt.Sprintf("\n\n%v", assessPipe))
+
+	if e := provenanceRows(specs, "assess", specs.getQuery("assess"), assessPipe.Rows()); e != nil {
+		return e
+	}
+
+	workers, e := specs.assessWorkers()
+	if e != nil {
+		return e
+	}
+
+	if e := interrupted(ctx); e != nil {
+		return e
+	}
 
-	// plot curves
+	// fitted values, shared by the curves and assessments
+	nnP, e := sea.PredictNN(specs.modelRoot(), assessPipe, false)
+	if e != nil {
+		return e
+	}
+
+	if e := specs.checkOutputs(nnP.OutputCols()); e != nil {
+		return e
+	}
+
+	jobs := make([]*assessJob, 0)
 	for _, curve := range specs.slicer("curves") {
-		sl := curve
-		if e := curves(assessPipe, specs, obsFt, &sl); e != nil {
-			return e
-		}
-		runtime.GC()
+		sl := curve // bad to pass for var as a pointer
+		jobs = append(jobs, &assessJob{curve: true, sl: &sl, log: log.buffered()})
 	}
 
-	// Marginal and KS/Decile/SegPlot plots
 	for _, slice := range specs.slicer("assess") {
-		sl := slice                                  // bad to pass for var as a pointer
-		baseFt := assessPipe.GetFType(slice.feature) // this may not be in fts
-		if baseFt.Role == sea.FRCts {
+		sl := slice
+		if baseFt := assessPipe.GetFType(slice.feature); baseFt != nil && baseFt.Role == sea.FRCts {
 			return fmt.Errorf("cannot slice on continuous feature: %s", slice.feature)
 		}
 
-		if e := marginal(specs, &sl, baseFt, obsFt, fts, conn); e != nil {
-			return e
+		jobs = append(jobs, &assessJob{sl: &sl, log: log.buffered()})
+	}
+
+	// the graph directories of the jobs are made before the jobs run.  Each job makes subdirectories of only its own.
+	for _, job := range jobs {
+		if job.curve {
+			continue
 		}
-		runtime.GC()
 
-		if e := assess(assessPipe, specs, obsFt, &sl, log); e != nil {
+		for _, dirType := range []string{"assess", "marginal"} {
+			if _, e := specs.gDir(dirType, job.sl); e != nil {
+				return e
+			}
+		}
+	}
+
+	// curves and Marginal and KS/Decile/SegPlot plots
+	e = runJobs(ctx, jobs, workers, log, func(job *assessJob) error {
+		if job.curve {
+			return curves(nnP, assessPipe, specs, obsFt, job.sl)
+		}
+
+		baseFt := assessPipe.GetFType(job.sl.feature) // this may not be in fts
+		if baseFt == nil {
+			return fmt.Errorf("feature %s not in pipeline", job.sl.feature)
+		}
+
+		if e := marginal(specs, job.sl, baseFt, obsFt, fts, conn); e != nil {
 			return e
 		}
-		runtime.GC()
+
+		return assess(nnP, assessPipe, specs, obsFt, job.sl, job.log)
+	})
+	if e != nil {
+		return e
 	}
 
 	// save assess data & model values back to ClickHouse
@@ -69,15 +119,76 @@ func assessModel(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
-	elapsed := time.Since(start).Minutes()
-	logger(log, fmt.Sprintf("assessment run time: %0.1f minutes", elapsed), true)
+	log.end("assessment", start)
+
+	return nil
+}
+
+// assessJob is a curve or an assessment (marginal, KS/Decile and SegPlot plots) to run.
+type assessJob struct {
+	curve bool    // true if the job is a curve
+	sl    *slices // curve or assessment spec
+	log   *runLog // buffered log for the job
+}
+
+// runJobs runs the jobs, workers at a time.  The jobs' logs are written to log in the order of jobs, so the
+// output does not depend on the order in which the jobs finish.  After a job fails, jobs not yet started are
+// skipped, as are jobs not yet started when ctx is done.  The error returned is that of the first failed job in jobs.
+func runJobs(ctx context.Context, jobs []*assessJob, workers int, log *runLog, run func(job *assessJob) error) error {
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+
+	errs := make([]error, len(jobs))
+	next := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ind := range next {
+				if failed.Load() {
+					continue
+				}
+
+				if errs[ind] = interrupted(ctx); errs[ind] != nil {
+					continue
+				}
+
+				if errs[ind] = run(jobs[ind]); errs[ind] != nil {
+					failed.Store(true)
+				}
+				runtime.GC()
+			}
+		}()
+	}
+
+	for ind := range jobs {
+		next <- ind
+	}
+
+	close(next)
+	wg.Wait()
+
+	for ind, job := range jobs {
+		job.log.flush(log)
+
+		if errs[ind] != nil {
+			return errs[ind]
+		}
+	}
 
 	return nil
 }
 
 // curves outputs curves of fitted & actual versus the values of another feature.  Often, the other feature
 // will be related to time.
-func curves(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, curveSpec *slices) error {
+//
+//   - nnP: model run on pipe
+func curves(nnP *sea.NNModel, pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, curveSpec *slices) error {
 	if pipe.GetFType(curveSpec.feature) == nil {
 		return fmt.Errorf("feature %s not in pipeline", curveSpec.name)
 	}
@@ -94,15 +205,7 @@ func curves(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, curveSpec *slic
 		FileName: fmt.Sprintf("%s%s.html", specs.getVal("curvesDir", true), curveSpec.shortName),
 	}
 
-	modelLoc := specs.modelRoot()
-
-	nnP, e := sea.PredictNN(modelLoc, pipe, false)
-	if e != nil {
-		return e
-	}
-
 	nCat := nnP.OutputCols()
-
 	baseSl, e := sea.NewSlice(curveSpec.feature, minCount, pipe, nil)
 	if e != nil {
 		return e
@@ -161,6 +264,10 @@ func curves(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, curveSpec *slic
 	return sea.Plotter(fig, nil, pd)
 }
 
+// marginalMu serializes sea.Marginal, which loads the model and builds its graph for each plot.  seafan and gorgonia
+// don't say that's safe to do concurrently.
+var marginalMu sync.Mutex
+
 // marginal generates the marginal response plots of the features in the model.
 //
 //   - exist: directory of existing models
@@ -195,14 +302,7 @@ func marginal(specs specsMap, valSpec *slices, baseFt, obsFt *sea.FType, fts sea
 		if pathMarg, e = makeSubDir(graphDir, subDir); e != nil {
 			return e
 		}
-		qry := fmt.Sprintf("%s AND %s=", specs.getQuery("assess"), valSpec.feature)
-
-		switch lvl.(type) {
-		case string:
-			qry = fmt.Sprintf("%s '%s' ORDER BY rand32(10) LIMIT 10000", qry, lvl)
-		default:
-			qry = fmt.Sprintf("%s %v ORDER BY rand32(10) LIMIT 10000", qry, lvl)
-		}
+		qry := marginalQuery(specs, valSpec.feature, lvl)
 
 		if pipe, e = newPipe(qry, "marginal", specs, 0, fts, conn); e != nil {
 			return e
@@ -218,7 +318,11 @@ func marginal(specs specsMap, valSpec *slices, baseFt, obsFt *sea.FType, fts sea
 				fldName = fld + "Oh"
 			}
 
-			if e := sea.Marginal(modelLoc, fldName, valSpec.target, pipe, pd, obsFt); e != nil {
+			marginalMu.Lock()
+			e := sea.Marginal(modelLoc, fldName, valSpec.target, pipe, pd, obsFt)
+			marginalMu.Unlock()
+
+			if e != nil {
 				return e
 			}
 		}
@@ -227,12 +331,27 @@ func marginal(specs specsMap, valSpec *slices, baseFt, obsFt *sea.FType, fts sea
 	return nil
 }
 
+// marginalQuery returns the query that pulls the data for the marginal plots of the slice feature=lvl.
+func marginalQuery(specs specsMap, feature string, lvl any) string {
+	qry := fmt.Sprintf("%s AND %s=", specs.getQuery("assess"), feature)
+
+	switch lvl.(type) {
+	case string:
+		return fmt.Sprintf("%s '%s' ORDER BY rand32(10) LIMIT 10000", qry, lvl)
+	default:
+		return fmt.Sprintf("%s %v ORDER BY rand32(10) LIMIT 10000", qry, lvl)
+	}
+}
+
 // assess generates KS, Decile and SegPlot plots of the features in the model plus any fields specified by the key assessAddl.
 //
 //   - segSpec : feature to segment the output on.
 //   - obsFT: sea.FType of the target field
-func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices, log *os.File) error {
-	if pipe.GetFType(segSpec.feature) == nil {
+//   - nnP: model run on assessPipe
+//   - assessPipe: assess data.  This is not changed, the fitted and observed values are added to a copy of the fields
+//     used.
+func assess(nnP *sea.NNModel, assessPipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices, log *runLog) error {
+	if assessPipe.GetFType(segSpec.feature) == nil {
 		return fmt.Errorf("feature %s not in pipeline", segSpec.feature)
 	}
 
@@ -253,13 +372,6 @@ func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices
 		return e
 	}
 
-	modelLoc := specs.modelRoot()
-
-	nnP, e := sea.PredictNN(modelLoc, pipe, false)
-	if e != nil {
-		return e
-	}
-
 	nCat := nnP.OutputCols()
 
 	// get model output.
@@ -279,6 +391,12 @@ func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices
 
 	obs = sea.UnNormalize(obs, obsFt)
 
+	// other jobs share assessPipe, so work on a copy of the fields used here
+	pipe, e := subPipe(assessPipe, append(specs.assessFields(), segSpec.feature)...)
+	if e != nil {
+		return e
+	}
+
 	// add them to the pipeline
 	if e1 := pipe.GData().AppendField(sea.NewRawCast(fit, nil), "fit", sea.FRCts); e1 != nil {
 		return e1
@@ -302,10 +420,13 @@ func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices
 		if e1 != nil {
 			return e1
 		}
-		logger(log, fmt.Sprintf("\n\nModel Assessment\nKS - %s: %0.1f%%\n\n", segSpec.name, ks), true)
+		log.metric("ks", ks, map[string]any{"assessment": segSpec.shortName, "name": segSpec.name},
+			fmt.Sprintf("\n\nModel Assessment\nKS - %s: %0.1f%%\n\n", segSpec.name, ks), true)
 
 	case sea.FRCts:
-		logger(log, fmt.Sprintf("\n\nModel Assessment\n R-Squared %0.1f%%\n\n", sea.R2(obs, fit)), true)
+		r2 := sea.R2(obs, fit)
+		log.metric("r2", r2, map[string]any{"assessment": segSpec.shortName, "name": segSpec.name},
+			fmt.Sprintf("\n\nModel Assessment\n R-Squared %0.1f%%\n\n", r2), true)
 	}
 
 	pd.Title, pd.FileName = fmt.Sprintf("%s<br>Decile-%s", specs.getVal("title", false), segSpec.name), graphDir+"decileAll.html"
@@ -318,7 +439,6 @@ func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices
 	if e != nil {
 		return e
 	}
-	runtime.GC()
 
 	// run through the values we're slicing on
 	for baseSl.Iter() {
@@ -357,9 +477,14 @@ func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices
 			ksTitle := fmt.Sprintf("%s<br>%s<br>restrict %s", specs.getVal("title", false), segSpec.name, baseSl.Title())
 			pd.FileName, pd.Title = ksFile, ksTitle
 
-			if _, _, _, e = sea.KS(xy, pd); e != nil {
-				return e
+			ks, _, _, e1 := sea.KS(xy, pd)
+			if e1 != nil {
+				return e1
 			}
+
+			log.metric("ks", ks, map[string]any{"assessment": segSpec.shortName, "name": segSpec.name,
+				"slicer": segSpec.feature, "level": fmt.Sprintf("%v", baseSl.Value())},
+				fmt.Sprintf("KS - %s restrict %s: %0.1f%%", segSpec.name, baseSl.Title(), ks), false)
 		}
 
 		pd.FileName, pd.Title, pd.STitle = pltFile, pltTitle, ""
@@ -388,6 +513,23 @@ func assess(pipe sea.Pipeline, specs specsMap, obsFt *sea.FType, segSpec *slices
 	return nil
 }
 
+// subPipe returns a pipeline with a copy of the fields of pipe.  Fields not in pipe are skipped.
+func subPipe(pipe sea.Pipeline, fields ...string) (sea.Pipeline, error) {
+	fts := make(sea.FTypes, 0)
+	for _, ft := range pipe.GetFTypes() {
+		if searchSlice(ft.Name, fields) >= 0 || (ft.From != "" && searchSlice(ft.From, fields) >= 0) {
+			fts = append(fts, ft)
+		}
+	}
+
+	gd, e := pipe.GData().UpdateFts(fts)
+	if e != nil {
+		return nil, e
+	}
+
+	return sea.NewVecData("assess", gd), nil
+}
+
 // TODO: add implementation check after save
 
 // TODO: implement trim option in pipeline
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunJobs(t *testing.T) {
+	errJob := errors.New("job failed")
+
+	tests := []struct {
+		name    string
+		jobs    int
+		workers int
+		fail    map[int]bool // jobs that fail
+		cancel  int          // cancel ctx when this job runs, -1 for never
+		ran     func(n int32) bool
+		wantErr error
+	}{
+		{name: "all", jobs: 8, workers: 3, cancel: -1, ran: func(n int32) bool { return n == 8 }},
+		{name: "one worker", jobs: 5, workers: 1, cancel: -1, ran: func(n int32) bool { return n == 5 }},
+		{name: "more workers than jobs", jobs: 2, workers: 6, cancel: -1, ran: func(n int32) bool { return n == 2 }},
+		{name: "stop on failure", jobs: 6, workers: 1, fail: map[int]bool{2: true}, cancel: -1,
+			ran: func(n int32) bool { return n == 3 }, wantErr: errJob},
+		{name: "first failure in order", jobs: 6, workers: 6, fail: map[int]bool{1: true, 4: true}, cancel: -1,
+			ran: func(n int32) bool { return n >= 2 }, wantErr: errJob},
+		{name: "cancelled", jobs: 6, workers: 1, cancel: 1,
+			ran: func(n int32) bool { return n == 2 }, wantErr: errInterrupted},
+		{name: "cancelled before", jobs: 4, workers: 2, cancel: 0,
+			ran: func(n int32) bool { return n <= 2 }, wantErr: errInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			log, e := newRunLog(dir, false, levelDebug)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			jobs := make([]*assessJob, tt.jobs)
+			index := make(map[*assessJob]int)
+			for ind := range jobs {
+				jobs[ind] = &assessJob{log: log.buffered()}
+				index[jobs[ind]] = ind
+			}
+
+			var ran atomic.Int32
+			e = runJobs(ctx, jobs, tt.workers, log, func(job *assessJob) error {
+				ind := index[job]
+				ran.Add(1)
+
+				if ind == tt.cancel {
+					cancel()
+				}
+
+				// later jobs finish first
+				time.Sleep(time.Duration(tt.jobs-ind) * time.Millisecond)
+				job.log.info("job", fmt.Sprintf("job %d", ind), false)
+
+				if tt.fail[ind] {
+					return fmt.Errorf("job %d: %w", ind, errJob)
+				}
+
+				return nil
+			})
+
+			if !errors.Is(e, tt.wantErr) {
+				t.Errorf("runJobs() error = %v, want %v", e, tt.wantErr)
+			}
+
+			if tt.wantErr == errJob && !strings.HasPrefix(e.Error(), fmt.Sprintf("job %d:", firstKey(tt.fail))) {
+				t.Errorf("runJobs() error = %v, want the first failed job's", e)
+			}
+
+			if n := ran.Load(); !tt.ran(n) {
+				t.Errorf("%d jobs ran", n)
+			}
+
+			if e := log.Close(); e != nil {
+				t.Fatal(e)
+			}
+
+			buf, e := os.ReadFile(dir + "model.log")
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			// the logs of the jobs that ran are written in the order of the jobs, up to the job returned
+			lines := strings.Fields(strings.ReplaceAll(string(buf), "job ", "job"))
+			if tt.wantErr == nil && len(lines) != tt.jobs {
+				t.Errorf("%d log lines, want %d", len(lines), tt.jobs)
+			}
+
+			for ind, line := range lines {
+				if want := fmt.Sprintf("job%d", ind); line != want {
+					t.Errorf("log line %d = %s, want %s", ind, line, want)
+				}
+			}
+		})
+	}
+}
+
+// firstKey returns the smallest key of m.
+func firstKey(m map[int]bool) int {
+	first := -1
+	for key := range m {
+		if first < 0 || key < first {
+			first = key
+		}
+	}
+
+	return first
+}
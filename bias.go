@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"os"
 	"time"
 
 	"gonum.org/v1/gonum/diff/fd"
@@ -59,7 +59,7 @@ func getOutLayer(modSpec sea.ModSpec) (outLayer *sea.FCLayer, outLayLoc int) {
 //     where
 //     O(k) is the average of the number of rows in biasQuery that have class k for the target value.
 //  6. Select (b(1),..,b(m-2)) to minimize SSE.
-func biasCorrect(specs specsMap, conn *chutils.Connect, log *os.File) error {
+func biasCorrect(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
 	var (
 		sseFn     objFn
 		bAdj      []float64
@@ -70,7 +70,7 @@ func biasCorrect(specs specsMap, conn *chutils.Connect, log *os.File) error {
 	)
 
 	start := time.Now()
-	logger(log, fmt.Sprintf("starting bias correction @ %s", start.Format(time.UnixDate)), true)
+	log.start("bias correction", start)
 
 	if fts, e = sea.LoadFTypes(specs.getVal("modelDir", true) + "fieldDefs.jsn"); e != nil {
 		return e
@@ -80,6 +80,10 @@ func biasCorrect(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
+	if e := interrupted(ctx); e != nil {
+		return e
+	}
+
 	// get model predictions from the unadjusted model.
 	nnModel, err := sea.PredictNN(specs.modelRoot(), modelPipe, false)
 	if err != nil {
@@ -124,14 +128,15 @@ func biasCorrect(specs specsMap, conn *chutils.Connect, log *os.File) error {
 	}
 
 	if optimal, e = optimize.Minimize(problem, bAdj, settings, &optimize.Newton{}); e != nil {
-		logger(log, fmt.Sprintf("%s -- check SSE is reasonable", e.Error()), true)
+		log.warn("optimizer", fmt.Sprintf("%s -- check SSE is reasonable", e.Error()))
 	}
 	if optimal == nil {
-		panic("biasCorrect: biasCorrect failed")
+		return fmt.Errorf("biasCorrect: optimizer failed")
 	}
 
-	logger(log, fmt.Sprintln("bias corrections factors", optimal.X), true)
-	logger(log, fmt.Sprintf("fit SSE: %0.5f", sseFn(optimal.X)), true)
+	log.info("biasAdjustment", fmt.Sprintln("bias corrections factors", optimal.X), true)
+	sse := sseFn(optimal.X)
+	log.metric("biasSSE", sse, map[string]any{"adjustment": optimal.X}, fmt.Sprintf("fit SSE: %0.5f", sse), true)
 
 	// insert the optimal into the model
 	nodeName := fmt.Sprintf("lBias%d", outLayLoc)
@@ -174,15 +179,22 @@ func biasCorrect(specs specsMap, conn *chutils.Connect, log *os.File) error {
 	// update the modelDir: key to point to the bias-adjusted model
 	specs.assign("modelDir", loc)
 
-	elapsed := time.Since(start).Minutes()
-	logger(log, fmt.Sprintf("assessment run time: %0.1f minutes", elapsed), true)
+	if e := updateProvenance(specs, func(p *provenance) {
+		p.Queries["bias"] = specs.getQuery("bias")
+		p.Rows["bias"] = modelPipe.Rows()
+		p.BiasAdjustment = optimal.X
+	}); e != nil {
+		return e
+	}
+
+	log.end("bias correction", start)
 
 	return nil
 }
 
 // buildObj builds the objective function we're going to optimize to find the bias adjustment.  The formulas are
 // given under biasCorrect.
-func buildObj(pipe sea.Pipeline, nnModel *sea.NNModel, log *os.File) (objFn, []float64, error) {
+func buildObj(pipe sea.Pipeline, nnModel *sea.NNModel, log *runLog) (objFn, []float64, error) {
 	// get fit probabilities
 	probs := nnModel.FitSlice()
 
@@ -225,7 +237,7 @@ func buildObj(pipe sea.Pipeline, nnModel *sea.NNModel, log *os.File) (objFn, []f
 		trgRates[ind] /= float64(nRow)
 	}
 
-	logger(log, fmt.Sprintf("bias correction target rates: %v", trgRates), true)
+	log.info("targetRates", fmt.Sprintf("bias correction target rates: %v", trgRates), true)
 
 	// build objective function for optimizer...sse of average phat to bias query target
 	biasSse := func(biasAdj []float64) float64 {
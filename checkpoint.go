@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// manifestFile is the name of the run manifest in outDir
+const manifestFile = "run.json"
+
+// manifest records the progress of a run.  It is kept in outDir and updated as each stage completes.
+// With -resume, completed stages are skipped and their outputs (tables, model files) are reused.
+type manifest struct {
+	SpecsFile string         `json:"specsFile"` // .gom file that started the run
+	SpecsHash string         `json:"specsHash"` // sha256 of the .gom file
+	Started   time.Time      `json:"started"`   // time the run started
+	Stages    []*stageRecord `json:"stages"`    // completed stages, in the order completed
+	LastError string         `json:"lastError"` // error that stopped the last attempt, if any
+}
+
+// stageRecord is a completed stage.  Stages are the stage keys (e.g. buildModel) plus the steps of buildData (tape,
+// pass1, pass2, pass3).
+type stageRecord struct {
+	Name      string    `json:"name"`      // stage name
+	Completed time.Time `json:"completed"` // time the stage completed
+	Tables    []string  `json:"tables"`    // ClickHouse tables the stage created
+}
+
+// newManifest creates a new manifest for specsFile
+func newManifest(specsFile string, includes ...string) (*manifest, error) {
+	hash, e := fileHash(append([]string{specsFile}, includes...)...)
+	if e != nil {
+		return nil, e
+	}
+
+	return &manifest{SpecsFile: specsFile, SpecsHash: hash, Started: time.Now()}, nil
+}
+
+// loadManifest loads the manifest from outDir.
+func loadManifest(outDir string) (*manifest, error) {
+	buf, e := os.ReadFile(slash(outDir) + manifestFile)
+	if e != nil {
+		return nil, e
+	}
+
+	man := &manifest{}
+	if e := json.Unmarshal(buf, man); e != nil {
+		return nil, fmt.Errorf("cannot parse %s%s: %v", slash(outDir), manifestFile, e)
+	}
+
+	return man, nil
+}
+
+// save saves the manifest to outDir.
+func (m *manifest) save(outDir string) error {
+	buf, e := json.MarshalIndent(m, "", "  ")
+	if e != nil {
+		return e
+	}
+
+	return os.WriteFile(slash(outDir)+manifestFile, buf, 0644)
+}
+
+// stage returns the record for the stage name, nil if the stage hasn't completed.
+func (m *manifest) stage(name string) *stageRecord {
+	// the last record is the most recent
+	for ind := len(m.Stages) - 1; ind >= 0; ind-- {
+		if m.Stages[ind].Name == name {
+			return m.Stages[ind]
+		}
+	}
+
+	return nil
+}
+
+// fileHash returns the sha256 hash of the contents of fileNames, in order
+func fileHash(fileNames ...string) (string, error) {
+	buf := make([]byte, 0)
+	for _, fileName := range fileNames {
+		b, e := os.ReadFile(fileName)
+		if e != nil {
+			return "", e
+		}
+
+		buf = append(buf, b...)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(buf)), nil
+}
+
+// initManifest starts the manifest for this run.  If we're resuming, the manifest must already exist and the specs
+// must not have changed since the run started, unless force is true.  If we're building the data or model, a new
+// manifest is started. Otherwise, the stages are added to the existing manifest, if there is one.  includes are the
+// files specsFile includes.
+func initManifest(specs specsMap, force bool, specsFile string, includes ...string) (warning string, err error) {
+	outDir := specs.getVal("outDir", true)
+
+	man, e := loadManifest(outDir)
+	switch {
+	case specs.resume():
+		if e != nil {
+			return "", fmt.Errorf("cannot resume, no run manifest in %s: %v", outDir, e)
+		}
+
+		hash, e := fileHash(append([]string{specsFile}, includes...)...)
+		if e != nil {
+			return "", e
+		}
+
+		if hash != man.SpecsHash {
+			if !force {
+				return "", &usageError{fmt.Errorf("cannot resume, %s has changed since the run started %s "+
+					"(use -force to resume anyway)", specsFile, man.Started.Format(time.UnixDate))}
+			}
+
+			warning = fmt.Sprintf("warning: %s has changed since the run started %s, resuming with -force",
+				specsFile, man.Started.Format(time.UnixDate))
+		}
+
+		return warning, nil
+	case specs.buildData() || specs.buildModel(), e != nil:
+		if man, e = newManifest(specsFile, includes...); e != nil {
+			return "", e
+		}
+	}
+
+	man.LastError = ""
+
+	return "", man.save(outDir)
+}
+
+// resume returns true if the run is resuming a prior run.
+func (sf specsMap) resume() bool {
+	return sf["resume"] == yes
+}
+
+// completed returns true if we're resuming and stage completed in the prior run.  Completed stages are logged.
+func completed(specs specsMap, stage string, log *runLog) bool {
+	if !specs.resume() {
+		return false
+	}
+
+	man, e := loadManifest(specs.getVal("outDir", true))
+	if e != nil {
+		return false
+	}
+
+	rec := man.stage(stage)
+	if rec == nil {
+		return false
+	}
+
+	log.info("skip", fmt.Sprintf("resume: skipping %s, completed @ %s", stage, rec.Completed.Format(time.UnixDate)), true)
+
+	return true
+}
+
+// checkpoint records that stage has completed and created tables.
+func checkpoint(specs specsMap, stage string, tables ...string) error {
+	outDir := specs.getVal("outDir", true)
+
+	man, e := loadManifest(outDir)
+	if e != nil {
+		return e
+	}
+
+	man.Stages = append(man.Stages, &stageRecord{Name: stage, Completed: time.Now(), Tables: tables})
+
+	return man.save(outDir)
+}
+
+// checkpointError records the error that stopped the run.
+func checkpointError(specs specsMap, err error) error {
+	outDir := specs.getVal("outDir", true)
+
+	man, e := loadManifest(outDir)
+	if e != nil {
+		return e
+	}
+
+	man.LastError = err.Error()
+
+	return man.save(outDir)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/invertedv/chutils"
+)
+
+// environment variables that supply connection values
+const (
+	envCredentials = "GOMORTGAGE_CREDENTIALS" // connection config file
+	envHost        = "GOMORTGAGE_HOST"
+	envPort        = "GOMORTGAGE_PORT"
+	envUser        = "GOMORTGAGE_USER"
+	envPassword    = "GOMORTGAGE_PASSWORD"
+)
+
+const (
+	defaultProfile = "default"
+	defaultHost    = "127.0.0.1"
+	defaultPort    = 9000
+)
+
+// connProfile holds the values needed to connect to ClickHouse.
+//
+// The connection config file is JSON with one entry per named profile, for example:
+//
+//	{
+//	  "default": {"host": "127.0.0.1", "user": "will", "password": "xyz"},
+//	  "prod": {"host": "10.0.0.12", "port": 9440, "user": "model", "password": "abc",
+//	           "memory": 80000000000, "tls": {"caFile": "/etc/ch/ca.pem"}}
+//	}
+type connProfile struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+	Memory   int64    `json:"memory"`  // max_memory_usage
+	GroupBy  int64    `json:"groupby"` // max_bytes_before_external_group_by
+	TLS      *tlsOpts `json:"tls"`     // if present, the connection uses TLS
+}
+
+// tlsOpts are the TLS options for a connection.
+type tlsOpts struct {
+	CAFile             string `json:"caFile"`             // CA certificate to verify the server
+	CertFile           string `json:"certFile"`           // client certificate
+	KeyFile            string `json:"keyFile"`            // client key
+	ServerName         string `json:"serverName"`         // server name to verify, if not host
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"` // do not verify the server certificate
+}
+
+// merge replaces values in cp with the non-zero values of from.
+func (cp *connProfile) merge(from *connProfile) {
+	if from.Host != "" {
+		cp.Host = from.Host
+	}
+
+	if from.Port != 0 {
+		cp.Port = from.Port
+	}
+
+	if from.User != "" {
+		cp.User = from.User
+	}
+
+	if from.Password != "" {
+		cp.Password = from.Password
+	}
+
+	if from.Memory != 0 {
+		cp.Memory = from.Memory
+	}
+
+	if from.GroupBy != 0 {
+		cp.GroupBy = from.GroupBy
+	}
+
+	if from.TLS != nil {
+		cp.TLS = from.TLS
+	}
+}
+
+// connFile returns the connection config file. This is, in order of precedence, the -creds flag,
+// the GOMORTGAGE_CREDENTIALS environment variable or $HOME/.goMortgage/connections.json.
+// must is true if the user specified the file.
+func connFile(opts *runOpts) (fileName string, must bool) {
+	if opts.credsFile != "" {
+		return opts.credsFile, true
+	}
+
+	if fileName = os.Getenv(envCredentials); fileName != "" {
+		return fileName, true
+	}
+
+	home, e := os.UserHomeDir()
+	if e != nil {
+		return "", false
+	}
+
+	return home + "/.goMortgage/connections.json", false
+}
+
+// readConnFile reads the profiles in fileName.  The file must not be accessible by group or others.
+func readConnFile(fileName string) (map[string]*connProfile, error) {
+	info, e := os.Stat(fileName)
+	if e != nil {
+		return nil, e
+	}
+
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("connection file %s has permissions %v, it must not be accessible by group or others (chmod 600)",
+			fileName, info.Mode().Perm())
+	}
+
+	buf, e := os.ReadFile(fileName)
+	if e != nil {
+		return nil, e
+	}
+
+	profiles := make(map[string]*connProfile)
+	if e := json.Unmarshal(buf, &profiles); e != nil {
+		return nil, fmt.Errorf("cannot parse connection file %s: %v", fileName, e)
+	}
+
+	return profiles, nil
+}
+
+// connection returns the connection values.  In increasing order of precedence, these come from:
+//   - defaults
+//   - the profile in the connection config file named by the connection: key (default: "default")
+//   - environment variables GOMORTGAGE_HOST, GOMORTGAGE_PORT, GOMORTGAGE_USER, GOMORTGAGE_PASSWORD
+//   - command-line flags
+func (sf specsMap) connection(opts *runOpts) (*connProfile, error) {
+	prof := &connProfile{Host: defaultHost, Port: defaultPort, Memory: maxMemoryDef, GroupBy: maxGroupByDef}
+
+	name, named := sf["connection"]
+	if !named {
+		name = defaultProfile
+	}
+
+	fileName, must := connFile(opts)
+	if _, e := os.Stat(fileName); e == nil || must || named {
+		profiles, e := readConnFile(fileName)
+		if e != nil {
+			return nil, e
+		}
+
+		from, ok := profiles[name]
+		if !ok && named {
+			return nil, fmt.Errorf("connection profile %s not in %s", name, fileName)
+		}
+
+		if ok {
+			prof.merge(from)
+		}
+	}
+
+	port := 0
+	if portStr := os.Getenv(envPort); portStr != "" {
+		p, e := strconv.Atoi(portStr)
+		if e != nil {
+			return nil, fmt.Errorf("bad %s: %s", envPort, portStr)
+		}
+		port = p
+	}
+
+	prof.merge(&connProfile{Host: os.Getenv(envHost), Port: port, User: os.Getenv(envUser),
+		Password: os.Getenv(envPassword)})
+
+	flags := &connProfile{}
+	if opts.flagSet("host") {
+		flags.Host = opts.host
+	}
+
+	if opts.flagSet("user") {
+		flags.User = opts.user
+	}
+
+	if opts.flagSet("pw") {
+		flags.Password = opts.pw
+	}
+
+	if opts.flagSet("memory") {
+		flags.Memory = opts.maxMemory
+	}
+
+	if opts.flagSet("groupby") {
+		flags.GroupBy = opts.maxGroupBy
+	}
+
+	prof.merge(flags)
+
+	return prof, nil
+}
+
+// tlsConfig returns the *tls.Config for the connection, nil if TLS is not used.
+func (cp *connProfile) tlsConfig() (*tls.Config, error) {
+	if cp.TLS == nil {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{ServerName: cp.TLS.ServerName, InsecureSkipVerify: cp.TLS.InsecureSkipVerify}
+
+	if cp.TLS.CAFile != "" {
+		pem, e := os.ReadFile(cp.TLS.CAFile)
+		if e != nil {
+			return nil, e
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cp.TLS.CAFile)
+		}
+	}
+
+	if cp.TLS.CertFile != "" || cp.TLS.KeyFile != "" {
+		cert, e := tls.LoadX509KeyPair(cp.TLS.CertFile, cp.TLS.KeyFile)
+		if e != nil {
+			return nil, e
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// connect connects to ClickHouse.
+func (cp *connProfile) connect() (*chutils.Connect, error) {
+	tlsCfg, e := cp.tlsConfig()
+	if e != nil {
+		return nil, e
+	}
+
+	conn := &chutils.Connect{Host: cp.Host, User: cp.User, Password: cp.Password}
+	conn.DB = clickhouse.OpenDB(
+		&clickhouse.Options{
+			TLS:  tlsCfg,
+			Addr: []string{fmt.Sprintf("%s:%d", cp.Host, cp.Port)},
+			Auth: clickhouse.Auth{
+				Database: "default",
+				Username: cp.User,
+				Password: cp.Password,
+			},
+			Settings: clickhouse.Settings{
+				"max_memory_usage":                   cp.Memory,
+				"max_bytes_before_external_group_by": cp.GroupBy,
+			},
+			DialTimeout: 5 * time.Second,
+			Compression: &clickhouse.Compression{
+				Method: clickhouse.CompressionLZ4,
+			},
+		})
+
+	return conn, conn.DB.Ping()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -185,15 +186,11 @@ func newPipe(qry, name string, specs specsMap, bSize int, fts sea.FTypes,
 // specs methods used:
 //   - goodLoan
 //   - pass1Fields
-func pass1(specs specsMap, conn *chutils.Connect, log *os.File) error {
-	specs.assign("goodLoan", specs.goodLoan())
-	specs.assign("where", "")
-
-	// put user where1 key in "where"
-	specs.getWhere(1)
-
-	specs.assign("fields", specs.pass1Fields())
-	qry := buildQuery(withPass1, specs)
+func pass1(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
+	qry, e := pass1Query(specs)
+	if e != nil {
+		return e
+	}
 
 	sampleSize, e := strconv.ParseInt(specs.getVal("sampleSize1", true), base10, bits32)
 	if e != nil {
@@ -209,6 +206,10 @@ func pass1(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
+	if e := stopPass(ctx, conn, log, specs.getVal("pass1Sample", true), specs.getVal("pass1Strat", true)); e != nil {
+		return e
+	}
+
 	if e := gen.MakeTable(); e != nil {
 		return e
 	}
@@ -217,7 +218,7 @@ func pass1(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
-	logger(log, fmt.Sprintf("Pass 1 Strats:\n%v", gen), false)
+	log.debug("strats", fmt.Sprintf("Pass 1 Strats:\n%v", gen))
 	return nil
 }
 
@@ -238,15 +239,11 @@ func pass1(specs specsMap, conn *chutils.Connect, log *os.File) error {
 //   - pass2Fields
 //   - mtgFields
 //   - plotShow
-func pass2(specs specsMap, conn *chutils.Connect, log *os.File) error {
-	// put user where2 key in "where"
-	specs.getWhere(2)
-	specs.assign("fields", fmt.Sprintf("%s, %s", specs.mtgFields(), specs.pass2Fields()))
-
-	// if there is no window, then withPass2 needs to add an arrayJoin
-	specs.windowExtras()
-
-	qry := buildQuery(withPass2, specs)
+func pass2(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
+	qry, e := pass2Query(specs)
+	if e != nil {
+		return e
+	}
 
 	sampleSize, e := strconv.ParseInt(specs.getVal("sampleSize2", true), base10, bits32)
 	if e != nil {
@@ -262,6 +259,10 @@ func pass2(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
+	if e := stopPass(ctx, conn, log, specs.getVal("pass2Sample", true), specs.getVal("pass2Strat", true)); e != nil {
+		return e
+	}
+
 	if e := gen.MakeTable(); e != nil {
 		return e
 	}
@@ -270,17 +271,19 @@ func pass2(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
-	logger(log, fmt.Sprintf("Pass 2 Strats:\n%v", gen), false)
+	log.debug("strats", fmt.Sprintf("Pass 2 Strats:\n%v", gen))
 
 	return nil
 }
 
-// pass3 joins the output of pass2 with economic data.
+// pass3 joins the output of pass2 with economic data.  The economic data at each geo level is built first, in a table
+// that's dropped when pass 3 is done.
 // pass3 requires the following field replacements:
-//   - with: With statement that defines to economic table
+//   - dates: anchor dates and lagged dates the economic data is pulled at
 //   - fields: fields to keep
 //   - pass2Sample: table of sampled loans output by pass2
-//   - econFields: field name to join the econ table to the loan-level table.
+//   - joins: joins of the economic data to the loan-level table.
+//   - econMatch: restricts the loans to those with economic data at each date.
 //
 // specs fields used directly:
 //   - modelTable: name of output table
@@ -288,11 +291,36 @@ func pass2(specs specsMap, conn *chutils.Connect, log *os.File) error {
 // specs methods used:
 //   - econJoin
 //   - pass3Fields
-func pass3(specs specsMap, conn *chutils.Connect) error {
-	econTable, econFields := specs.econJoin()
-	specs.assign("with", econTable)
-	specs.assign("fields", econFields+","+specs.pass3Fields())
-	qry := buildQuery(withPass3, specs)
+func pass3(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
+	qry, econ, e := pass3Query(specs)
+	if e != nil {
+		return e
+	}
+
+	tables := []string{specs.getVal("outTable", true)}
+	for _, tbl := range econ {
+		tables = append(tables, tbl.name)
+
+		rdr := s.NewReader(tbl.query, conn)
+		rdr.Name = tbl.name
+
+		if e := rdr.Init("month", chutils.MergeTree); e != nil {
+			return e
+		}
+
+		if e := rdr.TableSpec().Create(conn, tbl.name); e != nil {
+			return e
+		}
+
+		if e := stopPass(ctx, conn, log, tables...); e != nil {
+			return e
+		}
+
+		if e := rdr.Insert(); e != nil {
+			return e
+		}
+	}
+
 	rdr := s.NewReader(qry, conn)
 	rdr.Name = specs.getVal("outTable", true)
 
@@ -304,39 +332,221 @@ func pass3(specs specsMap, conn *chutils.Connect) error {
 		return e
 	}
 
+	if e := stopPass(ctx, conn, log, tables...); e != nil {
+		return e
+	}
+
 	if e := rdr.Insert(); e != nil {
 		return e
 	}
 
+	// outTable is built, so problems with the econ tables and the report are only warnings
+	if e := dropTables(conn, tables[1:]...); e != nil {
+		log.warn("dropTables", fmt.Sprintf("cannot drop the econ tables: %v", e))
+	}
+
+	if e := pass3Report(specs, conn, log); e != nil {
+		log.warn("pass3", fmt.Sprintf("cannot report the rows dropped: %v", e))
+	}
+
 	return nil
 }
 
-// data builds the modeling data
-func data(specs specsMap, conn *chutils.Connect, log *os.File) error {
+// pass3Report logs the number of rows of the pass 2 sample that were dropped for lack of economic data and, with
+// econFallback, the number at each geo level.  The counts come from the pass 2 sample and outTable.  They are rows
+// (loan/as-of-date pairs), not loans.
+func pass3Report(specs specsMap, conn *chutils.Connect, log *runLog) error {
+	var sampled, kept int64
+	qry := fmt.Sprintf("SELECT toInt64((SELECT count() FROM %s)), toInt64(count()) FROM %s",
+		specs.getVal("pass2Sample", true), specs.getVal("outTable", true))
+	if e := conn.QueryRow(qry).Scan(&sampled, &kept); e != nil {
+		return e
+	}
+
+	pct := func(n, of int64) float64 {
+		if of == 0 {
+			return 0
+		}
+
+		return 100 * float64(n) / float64(of)
+	}
+
+	report := &strings.Builder{}
+	_, _ = fmt.Fprintf(report, "pass 3: %d rows, %d dropped with no econ data (%0.1f%%)", kept, sampled-kept,
+		pct(sampled-kept, sampled))
+
+	// the join can only drop rows, unless the pass 2 sample changed under it
+	if kept > sampled {
+		_, _ = fmt.Fprintf(report, "\n  %s has more rows than %s", specs.getVal("outTable", true),
+			specs.getVal("pass2Sample", true))
+	}
+
+	if specs.getVal("econFallback", false) != "" {
+		rows, e := conn.Query(fmt.Sprintf(
+			"SELECT econLevel, toInt64(count()) FROM %s GROUP BY econLevel ORDER BY econLevel",
+			specs.getVal("outTable", true)))
+		if e != nil {
+			return e
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var (
+				level string
+				n     int64
+			)
+
+			if e := rows.Scan(&level, &n); e != nil {
+				return e
+			}
+
+			_, _ = fmt.Fprintf(report, "\n  econ data at %-8s for %d rows (%0.1f%%)", level, n, pct(n, kept))
+		}
+
+		if e := rows.Err(); e != nil {
+			return e
+		}
+	}
+
+	log.info("pass3", report.String(), true)
+
+	return nil
+}
+
+// pass1Query returns the pass1 query.  See pass1 for details.
+func pass1Query(specs specsMap) (string, error) {
+	goodLoan, e := specs.goodLoan()
+	if e != nil {
+		return "", fmt.Errorf("pass 1: %v", e)
+	}
+
+	fields, e := specs.pass1Fields()
+	if e != nil {
+		return "", fmt.Errorf("pass 1: %v", e)
+	}
+
+	specs.assign("goodLoan", goodLoan)
+	specs.assign("where", "")
+
+	// put user where1 key in "where"
+	specs.getWhere(1)
+
+	specs.assign("fields", fields)
+
+	return buildQuery(withPass1, specs), nil
+}
+
+// pass2Query returns the pass2 query.  See pass2 for details.
+func pass2Query(specs specsMap) (string, error) {
+	mtgFields, e := specs.mtgFields()
+	if e != nil {
+		return "", fmt.Errorf("pass 2: %v", e)
+	}
+
+	fields, e := specs.pass2Fields()
+	if e != nil {
+		return "", fmt.Errorf("pass 2: %v", e)
+	}
+
+	// put user where2 key in "where"
+	specs.getWhere(2)
+	specs.assign("fields", fmt.Sprintf("%s, %s", mtgFields, fields))
+
+	// if there is no window, then withPass2 needs to add an arrayJoin
+	specs.windowExtras()
+
+	return buildQuery(withPass2, specs), nil
+}
+
+// pass3Query returns the pass3 query and the econ tables it joins, which must be built first.  See pass3 for details.
+func pass3Query(specs specsMap) (qry string, tables []*econTable, err error) {
+	econ, e := specs.econJoin()
+	if e != nil {
+		return "", nil, fmt.Errorf("pass 3: %v", e)
+	}
+
+	fields, e := specs.pass3Fields()
+	if e != nil {
+		return "", nil, fmt.Errorf("pass 3: %v", e)
+	}
+
+	specs.assign("dates", econ.dates)
+	specs.assign("fields", econ.fields+","+fields)
+	specs.assign("joins", econ.joins)
+	specs.assign("econMatch", econ.match)
+
+	return buildQuery(withPass3, specs), econ.tables, nil
+}
+
+// data builds the modeling data.  If the run is interrupted, the pass under way stops after its current query and its
+// tables are dropped.  Completed passes are kept for -resume.
+func data(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
 	start := time.Now()
-	logger(log, fmt.Sprintf("starting data build @ %s", start.Format(time.UnixDate)), true)
+	log.start("data build", start)
+
+	// the loan tape, if there is one, is loaded into mtgDb before pass 1 reads it
+	if specs.loadsTape() && !completed(specs, "tape", log) {
+		if e := buildTape(ctx, specs, conn, log); e != nil {
+			return e
+		}
+
+		if e := checkpoint(specs, "tape", specs.tapeTables()...); e != nil {
+			return e
+		}
+
+		log.info("tape", "loan tape loaded", true)
+	}
 
 	// pass 1
-	if e := pass1(specs, conn, log); e != nil {
+	if e := interrupted(ctx); e != nil {
 		return e
 	}
 
-	logger(log, "pass 1 complete", true)
+	if !completed(specs, "pass1", log) {
+		if e := pass1(ctx, specs, conn, log); e != nil {
+			return e
+		}
+
+		if e := checkpoint(specs, "pass1", specs.getVal("pass1Sample", true), specs.getVal("pass1Strat", true)); e != nil {
+			return e
+		}
+
+		log.info("pass1", "pass 1 complete", true)
+	}
 
 	// pass 2
-	if e := pass2(specs, conn, log); e != nil {
+	if e := interrupted(ctx); e != nil {
 		return e
 	}
 
-	logger(log, "pass 2 complete", true)
+	if !completed(specs, "pass2", log) {
+		if e := pass2(ctx, specs, conn, log); e != nil {
+			return e
+		}
+
+		if e := checkpoint(specs, "pass2", specs.getVal("pass2Sample", true), specs.getVal("pass2Strat", true)); e != nil {
+			return e
+		}
+
+		log.info("pass2", "pass 2 complete", true)
+	}
 
 	// pass 3
-	if e := pass3(specs, conn); e != nil {
+	if e := interrupted(ctx); e != nil {
 		return e
 	}
 
-	elapsed := time.Since(start).Minutes()
-	logger(log, fmt.Sprintf("data build run time: %0.1f minutes", elapsed), true)
+	if !completed(specs, "pass3", log) {
+		if e := pass3(ctx, specs, conn, log); e != nil {
+			return e
+		}
+
+		if e := checkpoint(specs, "pass3", specs.getVal("outTable", true)); e != nil {
+			return e
+		}
+	}
+
+	log.end("data build", start)
 
 	return nil
 }
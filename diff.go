@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	sea "github.com/invertedv/seafan"
+)
+
+// maxLevels is the most category levels listed for a feature in a diff.
+const maxLevels = 10
+
+// runSummary is what diff compares in a run directory.  Parts that are missing from the directory are nil.
+type runSummary struct {
+	dir     string
+	specs   specsMap
+	fts     sea.FTypes
+	layers  sea.ModSpec
+	prov    *provenance
+	metrics map[string]float64
+}
+
+// loadRun reads the run in dir.  If the runs are versioned, dir may be outDir, in which case the latest run is read.
+func loadRun(dir string) (*runSummary, error) {
+	dir = runDir(slash(dir))
+
+	gf, e := readSpecsMap(dir+"model.gom", nil)
+	if e != nil {
+		return nil, fmt.Errorf("%s is not a run directory: %v", dir, e)
+	}
+
+	rs := &runSummary{dir: dir, specs: gf.specsMap}
+	modelDir := fmt.Sprintf("%s%s/", dir, gf.modelKey())
+
+	if fts, e := sea.LoadFTypes(modelDir + "fieldDefs.jsn"); e == nil {
+		rs.fts = fts
+	}
+
+	if layers, e := sea.LoadModSpec(modelDir + "modelS.nn"); e == nil {
+		rs.layers = layers
+	}
+
+	if prov, e := loadProvenance(modelDir); e == nil {
+		rs.prov = prov
+	}
+
+	if res, e := loadResult(dir); e == nil {
+		rs.metrics = res.metrics
+	}
+
+	return rs, nil
+}
+
+// differ writes the differences between two runs, section by section.  The section heading is written before the
+// first difference in the section.
+type differ struct {
+	w       io.Writer
+	section string
+	written bool // section heading written
+	count   int  // differences found
+}
+
+// start starts a new section.
+func (d *differ) start(section string) {
+	d.section, d.written = section, false
+}
+
+// add writes a difference.
+func (d *differ) add(format string, a ...any) {
+	if !d.written {
+		_, _ = fmt.Fprintf(d.w, "\n%s:\n", d.section)
+		d.written = true
+	}
+
+	_, _ = fmt.Fprintf(d.w, "  "+format+"\n", a...)
+	d.count++
+}
+
+// diff writes the differences between the runs in dir1 and dir2 to w.  The runs are compared by what they mean
+// rather than by their text: the keys of the specs, the features, the field definitions, the model architecture, the
+// fit and the assessment metrics.
+func diff(w io.Writer, dir1, dir2 string) error {
+	run1, e := loadRun(dir1)
+	if e != nil {
+		return &usageError{e}
+	}
+
+	run2, e := loadRun(dir2)
+	if e != nil {
+		return &usageError{e}
+	}
+
+	_, _ = fmt.Fprintf(w, "a: %s\nb: %s\n", run1.dir, run2.dir)
+
+	d := &differ{w: w}
+	d.specs(run1.specs, run2.specs)
+	d.features(run1.specs, run2.specs)
+	d.fieldDefs(run1.fts, run2.fts)
+	d.architecture(run1.layers, run2.layers)
+	d.fit(run1.prov, run2.prov)
+	d.metrics(run1.metrics, run2.metrics)
+
+	if d.count == 0 {
+		_, _ = fmt.Fprintln(w, "no differences")
+	}
+
+	return nil
+}
+
+// specs compares the keys of the specs.  Keys whose values are lists of features are compared by features.  outDir
+// differs between runs by design and is left out.
+func (d *differ) specs(sf1, sf2 specsMap) {
+	d.start("specs")
+
+	skip := append([]string{"outDir", "emb"}, listKeys...)
+	for _, key := range unionKeys(sf1, sf2) {
+		if searchSlice(key, skip) >= 0 {
+			continue
+		}
+
+		val1, ok1 := sf1[key]
+		val2, ok2 := sf2[key]
+		val1, val2 = strings.Join(strings.Fields(val1), " "), strings.Join(strings.Fields(val2), " ")
+
+		switch {
+		case !ok1:
+			d.add("+ %s: %s", key, val2)
+		case !ok2:
+			d.add("- %s: %s", key, val1)
+		case val1 != val2:
+			d.add("%s: %s -> %s", key, val1, val2)
+		}
+	}
+}
+
+// features compares the lists of features.  The order of the features does not matter.
+func (d *differ) features(sf1, sf2 specsMap) {
+	d.start("features")
+
+	for _, key := range append(append([]string{}, listKeys...), "emb") {
+		sep := ","
+		if key == "emb" {
+			sep = ";"
+		}
+
+		added, dropped := setDiff(featureList(sf1[key], sep), featureList(sf2[key], sep))
+		if len(added)+len(dropped) > 0 {
+			d.add("%s: %s", key, changes(added, dropped))
+		}
+	}
+
+	if sf1["target"] != sf2["target"] || sf1["targetType"] != sf2["targetType"] {
+		d.add("target: %s (%s) -> %s (%s)", sf1["target"], sf1["targetType"], sf2["target"], sf2["targetType"])
+	}
+}
+
+// fieldDefs compares the field definitions the models were fit with.
+func (d *differ) fieldDefs(fts1, fts2 sea.FTypes) {
+	d.start("fieldDefs.jsn")
+
+	if fts1 == nil || fts2 == nil {
+		if (fts1 == nil) != (fts2 == nil) {
+			d.add("only one run has fieldDefs.jsn")
+		}
+
+		return
+	}
+
+	names := make([]string, 0)
+	for _, ft := range fts1 {
+		names = append(names, ft.Name)
+	}
+
+	for _, ft := range fts2 {
+		if fts1.Get(ft.Name) == nil {
+			names = append(names, ft.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		ft1, ft2 := fts1.Get(name), fts2.Get(name)
+
+		switch {
+		case ft1 == nil:
+			d.add("+ %s (%v)", name, ft2.Role)
+			continue
+		case ft2 == nil:
+			d.add("- %s (%v)", name, ft1.Role)
+			continue
+		}
+
+		if ft1.Role != ft2.Role {
+			d.add("%s: role %v -> %v", name, ft1.Role, ft2.Role)
+		}
+
+		if ft1.EmbCols != ft2.EmbCols {
+			d.add("%s: embedding columns %d -> %d", name, ft1.EmbCols, ft2.EmbCols)
+		}
+
+		if ft1.FP == nil || ft2.FP == nil {
+			continue
+		}
+
+		if !closeTo(ft1.FP.Location, ft2.FP.Location) {
+			d.add("%s: mean %g -> %g", name, ft1.FP.Location, ft2.FP.Location)
+		}
+
+		if !closeTo(ft1.FP.Scale, ft2.FP.Scale) {
+			d.add("%s: sd %g -> %g", name, ft1.FP.Scale, ft2.FP.Scale)
+		}
+
+		if fmt.Sprint(ft1.FP.Default) != fmt.Sprint(ft2.FP.Default) {
+			d.add("%s: default %v -> %v", name, ft1.FP.Default, ft2.FP.Default)
+		}
+
+		added, dropped := setDiff(levels(ft1.FP.Lvl), levels(ft2.FP.Lvl))
+		if len(added)+len(dropped) > 0 {
+			d.add("%s: levels %s", name, changes(added, dropped))
+		}
+	}
+}
+
+// architecture compares the layers of the models.  The inputs are compared by fieldDefs.
+func (d *differ) architecture(layers1, layers2 sea.ModSpec) {
+	d.start("architecture")
+
+	if layers1 == nil || layers2 == nil {
+		if (layers1 == nil) != (layers2 == nil) {
+			d.add("only one run has modelS.nn")
+		}
+
+		return
+	}
+
+	// layers are matched by the longest common subsequence, so adding a layer reports only that layer
+	layers1, layers2 = dropInputs(layers1), dropInputs(layers2)
+	common := make([][]int, len(layers1)+1)
+	for ind := range common {
+		common[ind] = make([]int, len(layers2)+1)
+	}
+
+	for ind1 := len(layers1) - 1; ind1 >= 0; ind1-- {
+		for ind2 := len(layers2) - 1; ind2 >= 0; ind2-- {
+			switch {
+			case layers1[ind1] == layers2[ind2]:
+				common[ind1][ind2] = common[ind1+1][ind2+1] + 1
+			case common[ind1+1][ind2] > common[ind1][ind2+1]:
+				common[ind1][ind2] = common[ind1+1][ind2]
+			default:
+				common[ind1][ind2] = common[ind1][ind2+1]
+			}
+		}
+	}
+
+	ind1, ind2 := 0, 0
+	for ind1 < len(layers1) || ind2 < len(layers2) {
+		switch {
+		case ind1 < len(layers1) && ind2 < len(layers2) && layers1[ind1] == layers2[ind2]:
+			ind1, ind2 = ind1+1, ind2+1
+		case ind2 < len(layers2) && (ind1 == len(layers1) || common[ind1][ind2+1] >= common[ind1+1][ind2]):
+			d.add("+ layer %d: %s", ind2+1, layers2[ind2])
+			ind2++
+		default:
+			d.add("- layer %d: %s", ind1+1, layers1[ind1])
+			ind1++
+		}
+	}
+}
+
+// fit compares the best epochs and costs of the fits.
+func (d *differ) fit(prov1, prov2 *provenance) {
+	d.start("fit")
+
+	if prov1 == nil || prov2 == nil {
+		if (prov1 == nil) != (prov2 == nil) {
+			d.add("only one run has %s", provenanceFile)
+		}
+
+		return
+	}
+
+	if prov1.BestEpoch != prov2.BestEpoch {
+		d.add("best epoch: %d -> %d", prov1.BestEpoch, prov2.BestEpoch)
+	}
+
+	if prov1.Costs == nil || prov2.Costs == nil {
+		return
+	}
+
+	costs := []struct {
+		name       string
+		val1, val2 float64
+	}{
+		{"model cost, best", prov1.Costs.ModelBest, prov2.Costs.ModelBest},
+		{"validation cost, best", prov1.Costs.ValidationBest, prov2.Costs.ValidationBest},
+		{"model cost, final", prov1.Costs.ModelFinal, prov2.Costs.ModelFinal},
+		{"validation cost, final", prov1.Costs.ValidationFinal, prov2.Costs.ValidationFinal},
+	}
+
+	for _, cost := range costs {
+		if !closeTo(cost.val1, cost.val2) {
+			d.add("%s: %0.6g -> %0.6g (%+0.6g)", cost.name, cost.val1, cost.val2, cost.val2-cost.val1)
+		}
+	}
+}
+
+// metrics compares the overall KS and R-squared of the assessments.
+func (d *differ) metrics(met1, met2 map[string]float64) {
+	d.start("metrics")
+
+	for _, key := range unionKeys(met1, met2) {
+		val1, ok1 := met1[key]
+		val2, ok2 := met2[key]
+
+		switch {
+		case !ok1:
+			d.add("+ %s: %0.4f", key, val2)
+		case !ok2:
+			d.add("- %s: %0.4f", key, val1)
+		case !closeTo(val1, val2):
+			d.add("%s: %0.4f -> %0.4f (%+0.4f)", key, val1, val2, val2-val1)
+		}
+	}
+}
+
+// unionKeys returns the keys in either map, sorted.
+func unionKeys[V any](m1, m2 map[string]V) []string {
+	keys := make([]string, 0)
+	for key := range m1 {
+		keys = append(keys, key)
+	}
+
+	for key := range m2 {
+		if _, ok := m1[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// featureList splits a list of features on sep.  Spaces are removed.
+func featureList(val, sep string) []string {
+	feats := make([]string, 0)
+	for _, feat := range strings.Split(strings.ReplaceAll(val, " ", ""), sep) {
+		if feat != "" {
+			feats = append(feats, feat)
+		}
+	}
+
+	return feats
+}
+
+// setDiff returns the elements of list2 not in list1 and those of list1 not in list2, each sorted.
+func setDiff(list1, list2 []string) (added, dropped []string) {
+	for _, val := range list2 {
+		if searchSlice(val, list1) < 0 && searchSlice(val, added) < 0 {
+			added = append(added, val)
+		}
+	}
+
+	for _, val := range list1 {
+		if searchSlice(val, list2) < 0 && searchSlice(val, dropped) < 0 {
+			dropped = append(dropped, val)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(dropped)
+
+	return added, dropped
+}
+
+// changes formats the added and dropped elements of a list.  At most maxLevels of each are listed.
+func changes(added, dropped []string) string {
+	parts := make([]string, 0)
+	for _, list := range []struct {
+		sign string
+		vals []string
+	}{{"+", added}, {"-", dropped}} {
+		if len(list.vals) == 0 {
+			continue
+		}
+
+		vals := list.vals
+		if len(vals) > maxLevels {
+			vals = append(vals[:maxLevels:maxLevels], fmt.Sprintf("and %d more", len(list.vals)-maxLevels))
+		}
+
+		parts = append(parts, fmt.Sprintf("%s %s", list.sign, strings.Join(vals, ", ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// levels returns the levels of a categorical feature as strings.
+func levels(lvl sea.Levels) []string {
+	vals := make([]string, 0, len(lvl))
+	for val := range lvl {
+		vals = append(vals, fmt.Sprint(val))
+	}
+
+	return vals
+}
+
+// dropInputs removes the Input layer from layers.
+func dropInputs(layers sea.ModSpec) sea.ModSpec {
+	out := make(sea.ModSpec, 0, len(layers))
+	for _, layer := range layers {
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(layer)), "input") {
+			out = append(out, layer)
+		}
+	}
+
+	return out
+}
+
+// closeTo returns true if x and y are equal to about 9 digits.
+func closeTo(x, y float64) bool {
+	return math.Abs(x-y) <= 1e-9*math.Max(math.Abs(x), math.Abs(y))
+}
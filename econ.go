@@ -0,0 +1,762 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// econFiles are the .sql files that define the economic data at each geo level and the fields pulled from it.  The
+// WITH statements read the table given by the econDb key.  Any of the files may be replaced by a file of the same
+// name in the directory given by the econSql key.
+//
+//go:embed sql/econ
+var econFiles embed.FS
+
+// econLevel is a geo level of the economic data.
+type econLevel struct {
+	geo  string // field to join on.  It must be in both the loan-level data and the econ data.
+	file string // file in sql/econ that defines the econ data at this level as a WITH table
+}
+
+// econLevels are the geo levels of the econ data, by the name used in the econFields and econFallback keys.
+var econLevels = map[string]econLevel{
+	"zip3":     {geo: "zip3", file: "zip3With.sql"},
+	"zip5":     {geo: "zip", file: "zip5With.sql"},
+	"county":   {geo: "county", file: "countyWith.sql"},
+	"msa":      {geo: "msa", file: "msaWith.sql"},
+	"state":    {geo: "state", file: "stateWith.sql"},
+	"national": {geo: "", file: "nationalWith.sql"},
+}
+
+// econDate is a date the econ data is pulled at.
+type econDate struct {
+	pre    string // prefix of the fields at the date
+	corr   string // correlation of the joins
+	date   string // date field of the loan that's joined
+	anchor string // for an anchor, the fixed date that's added to the pass 2 sample as the date field
+	lags   bool   // if true, the fields of econLags are taken from the month known at the date
+	lag    int    // for a lagged date, the months the date field is moved back
+	of     string // for a lagged date, the date field it's lagged from
+}
+
+// loanDates are the dates of the loan the econ data is pulled at.  The as-of and first-pay dates are lagged, since a
+// model scored at those dates only knows the econ data published by then.
+var loanDates = []econDate{
+	{pre: "trg", corr: "b", date: "trgDt"},
+	{pre: "ao", corr: "c", date: "aoDt", lags: true},
+	{pre: "org", corr: "d", date: "fpDt", lags: true},
+}
+
+// lagged returns dt moved back lag months.  The date field, lagged by addMonths, is added to the pass 2 sample.
+func (dt econDate) lagged(lag int) econDate {
+	if lag == 0 {
+		return dt
+	}
+
+	suffix := fmt.Sprintf("Lag%d", lag)
+
+	return econDate{pre: dt.pre, corr: dt.corr + suffix, date: dt.date + suffix, lag: lag, of: dt.date}
+}
+
+// defaultAnchors is the anchor date used if there is no econAnchors key.
+const defaultAnchors = "y20=2020-01-01"
+
+// anchorPattern is the form of the name of an anchor date
+var anchorPattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// econDates returns the dates the econ data is pulled at: the dates of the loan and the anchor dates of the
+// econAnchors key, for instance
+//
+//	econAnchors: y15=2015-01-01, y20=2020-01-01, y24=2024-06-01
+//
+// The name of the anchor is the prefix of its fields (y15Hpi, y15PropVal) and the date field added to the pass 2
+// sample is the name followed by Dt (y15Dt).
+func (sf specsMap) econDates() ([]econDate, error) {
+	anchors, ok := sf["econAnchors"]
+	if !ok {
+		anchors = defaultAnchors
+	}
+
+	dates := append([]econDate{}, loanDates...)
+	for _, item := range toSlice(anchors, ",") {
+		name, dt, ok := strings.Cut(item, "=")
+		name, dt = strings.TrimSpace(name), strings.TrimSpace(dt)
+		if !ok || !anchorPattern.MatchString(name) {
+			return nil, fmt.Errorf("bad entry %s, must be name=yyyy-mm-dd with a lower-case name", item)
+		}
+
+		for _, d := range dates {
+			if name == d.pre || name+"Dt" == d.date {
+				return nil, fmt.Errorf("anchor %s is given twice or is the name of a loan date", name)
+			}
+		}
+
+		t, e := time.Parse("2006-01-02", dt)
+		if e != nil || t.Day() != 1 {
+			return nil, fmt.Errorf("anchor %s: date %s must be the first of a month as yyyy-mm-dd", name, dt)
+		}
+
+		dates = append(dates, econDate{pre: name, corr: "x" + capitalize(name), date: name + "Dt", anchor: dt})
+	}
+
+	return dates, nil
+}
+
+// econFieldPattern finds the econ field of an entry of the field list
+var econFieldPattern = regexp.MustCompile(`<corr>(\w+)`)
+
+// econField is an entry of the econ field list, fields.sql.
+type econField struct {
+	name  string // the field in the econ data
+	entry string // the entry, with placeholders <corr> and <pre>
+}
+
+// econFile returns the contents of the econ query fileName.  If the econSql key gives a directory that has the file,
+// it's read from there.  Otherwise, the built-in file is used.
+func (sf specsMap) econFile(fileName string) (string, error) {
+	if dir, ok := sf["econSql"]; ok {
+		buf, e := os.ReadFile(filepath.Join(dir, fileName))
+		if e == nil {
+			return string(buf), nil
+		}
+
+		if !os.IsNotExist(e) {
+			return "", e
+		}
+	}
+
+	buf, e := econFiles.ReadFile("sql/econ/" + fileName)
+	if e != nil {
+		return "", e
+	}
+
+	return string(buf), nil
+}
+
+// econFieldList returns the entries of the econ field list, fields.sql.  The format of an entry is
+//
+//	<corr><field> AS <pre><Field>
+//
+// Entries are separated by commas and may be calculations.  The econ field of the entry is the first field with
+// <corr>.
+func (sf specsMap) econFieldList() ([]econField, error) {
+	buf, e := sf.econFile("fields.sql")
+	if e != nil {
+		return nil, e
+	}
+
+	flds := make([]econField, 0)
+	for _, entry := range splitFields(buf) {
+		m := econFieldPattern.FindStringSubmatch(entry)
+		if m == nil {
+			return nil, fmt.Errorf("fields.sql: entry %s has no <corr> field", entry)
+		}
+
+		if aliasPattern.FindStringIndex(entry) == nil {
+			return nil, fmt.Errorf("fields.sql: entry %s has no AS <pre><Field>", entry)
+		}
+
+		flds = append(flds, econField{name: m[1], entry: entry})
+	}
+
+	return flds, nil
+}
+
+// econSpec returns the geo levels given by the econFields key.  The key is the default level, optionally followed
+// by the level of individual econ fields:
+//
+//	econFields: zip3, hpi=zip5, unempRate=msa, lbrForceTot=msa
+//
+// levels are the levels used, the default first.  fieldLevel is the level of each econ field that isn't at the
+// default level.
+func (sf specsMap) econSpec() (levels []string, fieldLevel map[string]string, err error) {
+	items := toSlice(sf["econFields"], ",")
+	if len(items) == 0 || strings.Contains(items[0], "=") {
+		return nil, nil, fmt.Errorf("the first entry must be the default geo level")
+	}
+
+	flds, e := sf.econFieldList()
+	if e != nil {
+		return nil, nil, e
+	}
+
+	known := make(map[string]bool)
+	for _, fld := range flds {
+		known[fld.name] = true
+	}
+
+	fieldLevel = make(map[string]string)
+	for ind, item := range items {
+		name, level, ok := strings.Cut(item, "=")
+		if !ok {
+			level = name
+		}
+		name, level = strings.TrimSpace(name), strings.TrimSpace(level)
+
+		if ind > 0 && !ok {
+			return nil, nil, fmt.Errorf("bad entry %s, must be field=level", item)
+		}
+
+		if _, ok := econLevels[level]; !ok {
+			return nil, nil, fmt.Errorf("unknown geo level %s, must be one of %s", level, econLevelNames())
+		}
+
+		if searchSlice(level, levels) < 0 {
+			levels = append(levels, level)
+		}
+
+		if ind == 0 {
+			continue
+		}
+
+		if !known[name] {
+			return nil, nil, fmt.Errorf("%s is not in the econ field list", name)
+		}
+
+		if _, ok := fieldLevel[name]; ok {
+			return nil, nil, fmt.Errorf("field %s is given twice", name)
+		}
+
+		fieldLevel[name] = level
+	}
+
+	return levels, fieldLevel, nil
+}
+
+// econLevelNames returns the names of the geo levels
+func econLevelNames() string {
+	names := make([]string, 0)
+	for name := range econLevels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// econCorr returns the suffix added to the correlations of the joins of level.  The default level, which is
+// levels[0], has none.
+func econCorr(level string, levels []string) string {
+	if level == levels[0] {
+		return ""
+	}
+
+	return capitalize(level)
+}
+
+// econFallback returns the geo levels the fields at the default level are taken from, in order: the default level
+// followed by the levels of the econFallback key, for instance
+//
+//	econFallback: msa, state, national
+func (sf specsMap) econFallback(levels []string) ([]string, error) {
+	chain := []string{levels[0]}
+	for _, level := range toSlice(sf["econFallback"], ",") {
+		if _, ok := econLevels[level]; !ok {
+			return nil, fmt.Errorf("unknown geo level %s, must be one of %s", level, econLevelNames())
+		}
+
+		if searchSlice(level, chain) >= 0 {
+			return nil, fmt.Errorf("level %s is given twice or is the default level", level)
+		}
+
+		chain = append(chain, level)
+	}
+
+	return chain, nil
+}
+
+// maxLag is the largest publication lag, in months, of econLags
+const maxLag = 24
+
+// econLags returns the publication lag, in months, of the econ fields given by the econLags key, for instance
+//
+//	econLags: hpi=2, unempRate=1
+//
+// At the as-of and first-pay dates, these fields are taken from the month that many months earlier, the last month
+// known at the date.  Fields that aren't given have no lag.
+func (sf specsMap) econLags(flds []econField) (map[string]int, error) {
+	known := make(map[string]bool)
+	for _, fld := range flds {
+		known[fld.name] = true
+	}
+
+	lags := make(map[string]int)
+	for _, item := range toSlice(sf["econLags"], ",") {
+		name, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad entry %s, must be field=months", item)
+		}
+
+		if !known[name] {
+			return nil, fmt.Errorf("%s is not in the econ field list", name)
+		}
+
+		if _, ok := lags[name]; ok {
+			return nil, fmt.Errorf("field %s is given twice", name)
+		}
+
+		lag, e := strconv.Atoi(val)
+		if e != nil || lag < 0 || lag > maxLag {
+			return nil, fmt.Errorf("lag of %s must be an integer from 0 to %d", name, maxLag)
+		}
+
+		lags[name] = lag
+	}
+
+	return lags, nil
+}
+
+// checkEconLevels checks that the pass 2 sample of the data source has the geo field of each level of econFields and
+// econFallback.  The key returned is the key with the level that can't be joined.
+func (sf specsMap) checkEconLevels() (key string, err error) {
+	levels, _, e := sf.econSpec()
+	if e != nil {
+		return "econFields", e
+	}
+
+	chain, e := sf.econFallback(levels)
+	if e != nil {
+		return "econFallback", e
+	}
+
+	have, e := sf.sampleFields()
+	if e != nil {
+		return "mtgFields", e
+	}
+
+	for ind, level := range append(levels, chain[1:]...) {
+		key = "econFields"
+		if ind >= len(levels) {
+			key = "econFallback"
+		}
+
+		if geo := econLevels[level].geo; geo != "" && !have[geo] {
+			return key, fmt.Errorf("level %s joins on %s, which source %s doesn't have", level, geo, sf["mtgFields"])
+		}
+	}
+
+	return "", nil
+}
+
+// econTable is the econ data at a geo level.  pass3 builds it before joining it to the pass 2 sample, so the econ
+// data is aggregated once rather than for each join.
+type econTable struct {
+	name  string // ClickHouse table: outTable followed by Econ and the level (e.g. tmp.modelEconZip3)
+	query string // query that aggregates econDb to the level
+}
+
+// withPattern finds the query of a WITH table: <name> AS (<query>)
+var withPattern = regexp.MustCompile(`(?is)^\s*\w+\s+AS\s*\((.*)\)\s*$`)
+
+// econLevelTable returns the econ table of level.  The query is read from the level's WITH statement.
+func (sf specsMap) econLevelTable(level string) (*econTable, error) {
+	with, e := sf.econFile(econLevels[level].file)
+	if e != nil {
+		return nil, e
+	}
+
+	m := withPattern.FindStringSubmatch(stripComments(with))
+	if m == nil {
+		return nil, fmt.Errorf("%s must have the form <name> AS (<query>)", econLevels[level].file)
+	}
+
+	return &econTable{
+		name:  sf["outTable"] + "Econ" + capitalize(level),
+		query: strings.TrimSpace(strings.ReplaceAll(m[1], "<econDb>", sf["econDb"])),
+	}, nil
+}
+
+// econSQL is the SQL pass3 uses to join the econ data to the pass 2 sample.
+type econSQL struct {
+	tables []*econTable // econ data at each geo level
+	dates  string       // anchor and lagged dates added to the pass 2 sample, each preceded by a comma
+	fields string       // econ fields to return from the query
+	joins  string       // joins of the econ data at each geo level and date
+	match  string       // WHERE clause that keeps the loans with econ data at each date
+}
+
+// econJoin is called for pass3 which joins the sampled goMortgage data to economic data.
+//
+// Economic data is pulled at these time periods per loan:
+//
+//   - first pay date
+//   - as-of date
+//   - target date
+//   - each anchor date of econAnchors (Jan 2020 by default)
+//
+// To accommodate this, the field list has the form:
+//
+//	<corr><base field> AS <pre><base field>
+//
+// where <base field> is the root field (e.g. HPI), <corr> is the correlation for the table (since it's joined at
+// each date at each level) and <pre> is a prefix (org, ao, trg or the name of the anchor, e.g. y20).  The entries of
+// anchorFields.sql, which have only <pre>, are added for each anchor date.
+//
+// The joins are LEFT JOINs.  A field at the default level is taken from the first level of econFallback that has
+// data for the loan at that date, and the field econLevel records the coarsest level used for the loan.  Loans with
+// no econ data at some date are dropped.
+//
+// Fields with a publication lag (econLags) are taken at the as-of and first-pay dates from the econ data joined at
+// the lagged date, which is added to the pass 2 sample (e.g. aoDtLag2).
+func (sf specsMap) econJoin() (*econSQL, error) {
+	levels, fieldLevel, e := sf.econSpec()
+	if e != nil {
+		return nil, e
+	}
+
+	chain, e := sf.econFallback(levels)
+	if e != nil {
+		return nil, e
+	}
+
+	flds, e := sf.econFieldList()
+	if e != nil {
+		return nil, e
+	}
+
+	lags, e := sf.econLags(flds)
+	if e != nil {
+		return nil, e
+	}
+
+	baseDates, e := sf.econDates()
+	if e != nil {
+		return nil, e
+	}
+
+	anchorFields, e := sf.econFile("anchorFields.sql")
+	if e != nil {
+		return nil, e
+	}
+
+	for _, level := range chain {
+		if searchSlice(level, levels) < 0 {
+			levels = append(levels, level)
+		}
+	}
+
+	// fieldLevels returns the levels fld may be taken from
+	fieldLevels := func(fld string) []string {
+		if l, ok := fieldLevel[fld]; ok {
+			return []string{l}
+		}
+
+		return chain
+	}
+
+	// the levels to join at each lag.  Every level is joined with no lag.
+	lagLevels := map[int][]string{0: levels}
+	lagList := make([]int, 0)
+	for _, fld := range flds {
+		lag := lags[fld.name]
+		if lag == 0 {
+			continue
+		}
+
+		if _, ok := lagLevels[lag]; !ok {
+			lagList = append(lagList, lag)
+		}
+
+		for _, level := range fieldLevels(fld.name) {
+			if searchSlice(level, lagLevels[lag]) < 0 {
+				lagLevels[lag] = append(lagLevels[lag], level)
+			}
+		}
+	}
+	sort.Ints(lagList)
+
+	// dates are the base dates followed by the lagged dates, with the levels joined at each
+	type joinDate struct {
+		econDate
+		levels []string
+	}
+
+	dates := make([]joinDate, 0)
+	for _, dt := range baseDates {
+		dates = append(dates, joinDate{dt, levels})
+	}
+
+	for _, dt := range baseDates {
+		if !dt.lags {
+			continue
+		}
+
+		for _, lag := range lagList {
+			dates = append(dates, joinDate{dt.lagged(lag), lagLevels[lag]})
+		}
+	}
+
+	// corr is the correlation of the join of level at the date dt
+	corr := func(dt econDate, level string) string {
+		return dt.corr + econCorr(level, levels)
+	}
+
+	tables := make(map[string]*econTable)
+	for _, level := range levels {
+		if tables[level], e = sf.econLevelTable(level); e != nil {
+			return nil, e
+		}
+	}
+
+	// the join is repeated for each level and date, so its comments are dropped
+	join := dropLines(withPass3Join, "//")
+
+	joinList, extra, matches, used := make([]string, 0), make([]string, 0), make([]string, 0), make([]string, 0)
+	for _, dt := range dates {
+		for _, level := range dt.levels {
+			geo, lvlJoin := econLevels[level].geo, join
+			if geo == "" {
+				lvlJoin = dropLines(join, "<geo>")
+			}
+
+			joinList = append(joinList, strings.NewReplacer("<econ>", tables[level].name, "<geo>", geo,
+				"<corr>", corr(dt.econDate, level), "<date>", dt.date).Replace(lvlJoin))
+		}
+
+		if dt.anchor != "" {
+			extra = append(extra, fmt.Sprintf(", toDate('%s') AS %s", dt.anchor, dt.date))
+		}
+
+		if dt.lag > 0 {
+			extra = append(extra, fmt.Sprintf(", addMonths(%s, -%d) AS %s", dt.of, dt.lag, dt.date))
+		}
+
+		// the loan must have data at this date at some level of the chain and at the other levels joined
+		hits, index := make([]string, 0), make([]string, 0)
+		for ind, level := range chain {
+			hit := econHit(corr(dt.econDate, level), dt.date)
+			hits = append(hits, hit)
+			index = append(index, fmt.Sprintf("%s, %d", hit, ind+1))
+		}
+
+		if searchSlice(levels[0], dt.levels) >= 0 {
+			matches = append(matches, "("+strings.Join(hits, " OR ")+")")
+			used = append(used, fmt.Sprintf("multiIf(%s, 0)", strings.Join(index, ", ")))
+		}
+
+		for _, level := range dt.levels {
+			if searchSlice(level, chain) < 0 {
+				matches = append(matches, econHit(corr(dt.econDate, level), dt.date))
+			}
+		}
+	}
+
+	// pick returns entry at the date dt.  At the default level, it's taken from the first level of the chain that
+	// has data.
+	pick := func(entry, level string, dt econDate) string {
+		entry = strings.ReplaceAll(entry, "<pre>", dt.pre)
+		at := func(level string) string {
+			return strings.ReplaceAll(entry, "<corr>", corr(dt, level)+".")
+		}
+
+		if level != levels[0] || len(chain) == 1 {
+			return at(level)
+		}
+
+		args := make([]string, 0)
+		for ind, l := range chain {
+			entryAt := at(l)
+			expr := strings.TrimSpace(entryAt[:aliasPattern.FindStringIndex(entryAt)[0]])
+			if ind == len(chain)-1 {
+				args = append(args, expr)
+				break
+			}
+
+			args = append(args, econHit(corr(dt, l), dt.date), expr)
+		}
+
+		return fmt.Sprintf("multiIf(%s) AS %s", strings.Join(args, ", "), fieldName(entry))
+	}
+
+	fieldList := []string{pick("<corr>msaNameLoc AS msaLocName", levels[0], baseDates[0])}
+	for _, dt := range baseDates {
+		for _, fld := range flds {
+			lag := 0
+			if dt.lags {
+				lag = lags[fld.name]
+			}
+
+			fieldList = append(fieldList, pick(fld.entry, fieldLevels(fld.name)[0], dt.lagged(lag)))
+		}
+
+		if dt.anchor != "" {
+			for _, entry := range splitFields(anchorFields) {
+				fieldList = append(fieldList, strings.ReplaceAll(entry, "<pre>", dt.pre))
+			}
+		}
+	}
+
+	if len(chain) > 1 {
+		fieldList = append(fieldList, fmt.Sprintf("arrayElement(['%s'], arrayMax([%s])) AS econLevel",
+			strings.Join(chain, "', '"), strings.Join(used, ", ")))
+	}
+
+	q := &econSQL{
+		dates:  strings.Join(extra, " "),
+		fields: strings.Join(fieldList, ",\n"),
+		joins:  strings.Join(joinList, "\n"),
+		match:  strings.Join(matches, "\n    AND "),
+	}
+
+	for _, level := range levels {
+		q.tables = append(q.tables, tables[level])
+	}
+
+	return q, nil
+}
+
+// econHit is true if the join with correlation corr found econ data at the loan's date field.  Unmatched rows of a
+// LEFT JOIN have the default month, since pass3.sql sets join_use_nulls to 0.
+func econHit(corr, date string) string {
+	return fmt.Sprintf("%s.month = a.%s", corr, date)
+}
+
+// dropLines returns text without the lines that contain sub.
+func dropLines(text, sub string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.Contains(line, sub) {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// aliasPattern finds the name of an entry of a field list that ends with "AS <name>".  The name may have placeholders.
+var aliasPattern = regexp.MustCompile(`(?is)\bAS\s+([\w<>]+)\s*$`)
+
+// checkPass3Fields checks that the fields with an econ prefix (trg, ao, org or an anchor, e.g. y20) that the pass 3
+// calculations of the data source use are econ fields, fields of the pass 2 sample or fields calculated in pass 3.
+func (sf specsMap) checkPass3Fields() error {
+	q, e := sf.econJoin()
+	if e != nil {
+		return e
+	}
+
+	// dates is valid, since econJoin succeeded
+	dates, _ := sf.econDates()
+	pres := make([]string, 0)
+	for _, dt := range dates {
+		pres = append(pres, dt.pre)
+	}
+
+	// econPrePattern finds the fields in a query that have an econ prefix
+	econPrePattern := regexp.MustCompile(fmt.Sprintf(`\b(?:%s)[A-Z]\w*`, strings.Join(pres, "|")))
+
+	known, e := sf.sampleFields()
+	if e != nil {
+		return e
+	}
+
+	pass3, e := sf.pass3Fields()
+	if e != nil {
+		return e
+	}
+
+	for _, list := range []string{q.fields, pass3} {
+		for _, entry := range splitFields(list) {
+			known[fieldName(entry)] = true
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, entry := range splitFields(pass3) {
+		for _, fld := range econPrePattern.FindAllString(entry, -1) {
+			if !known[fld] && searchSlice(fld, missing) < 0 {
+				missing = append(missing, fld)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("pass3Fields uses %s, not in the econ field list or the pass 2 sample", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// sampleFields returns the names of the fields of the pass 2 sample of the data source.
+func (sf specsMap) sampleFields() (map[string]bool, error) {
+	mtg, e := sf.mtgFields()
+	if e != nil {
+		return nil, e
+	}
+
+	pass2, e := sf.pass2Fields()
+	if e != nil {
+		return nil, e
+	}
+
+	names := make(map[string]bool)
+	for _, list := range []string{mtg, pass2} {
+		for _, entry := range splitFields(list) {
+			names[fieldName(entry)] = true
+		}
+	}
+
+	return names, nil
+}
+
+// stripComments returns text without its // comments.
+func stripComments(text string) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if ind := strings.Index(line, "//"); ind >= 0 {
+			line = line[:ind]
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// splitFields splits a field list into its entries.  Comments are dropped and commas inside parentheses, brackets
+// and quotes don't separate entries.
+func splitFields(list string) []string {
+	entries := make([]string, 0)
+	depth, quoted, start := 0, false, 0
+	text := stripComments(list)
+
+	for ind, ch := range text {
+		switch {
+		case ch == '\'':
+			quoted = !quoted
+		case quoted:
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth--
+		case ch == ',' && depth == 0:
+			entries = append(entries, strings.TrimSpace(text[start:ind]))
+			start = ind + 1
+		}
+	}
+	entries = append(entries, strings.TrimSpace(text[start:]))
+
+	out := make([]string, 0)
+	for _, entry := range entries {
+		if entry != "" {
+			out = append(out, entry)
+		}
+	}
+
+	return out
+}
+
+// fieldName returns the name of the field an entry of a field list creates: the alias or, for a field of a table,
+// the field (lns.fico is fico).
+func fieldName(entry string) string {
+	if m := aliasPattern.FindStringSubmatch(entry); m != nil {
+		return m[1]
+	}
+
+	return entry[strings.LastIndex(entry, ".")+1:]
+}
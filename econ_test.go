@@ -0,0 +1,287 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want []string
+	}{
+		{"simple", "a, b,c", []string{"a", "b", "c"}},
+		{"parentheses", "if(a, b, c) AS d, e", []string{"if(a, b, c) AS d", "e"}},
+		{"brackets", "arrayElement(['x', 'y'], 1) AS z", []string{"arrayElement(['x', 'y'], 1) AS z"}},
+		{"quotes", "'a,b' AS c, d", []string{"'a,b' AS c", "d"}},
+		{"comments", "// a, b\nc, // d\ne", []string{"c", "e"}},
+		{"empty entries", "a,, b,", []string{"a", "b"}},
+		{"empty", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitFields(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitFields(%q) = %q, want %q", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+	}{
+		{"fico", "fico"},
+		{"lns.fico", "fico"},
+		{"<corr>hpi AS <pre>Hpi", "<pre>Hpi"},
+		{"propVal * (y20Hpi / orgHpi) as y20PropVal", "y20PropVal"},
+		{"if(a, b, c)\n  AS d", "d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			if got := fieldName(tt.entry); got != tt.want {
+				t.Errorf("fieldName(%q) = %q, want %q", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEconDates(t *testing.T) {
+	tests := []struct {
+		name    string
+		anchors string // "" means no econAnchors key
+		want    []econDate
+		wantErr bool
+	}{
+		{name: "default", want: []econDate{{pre: "y20", corr: "xY20", date: "y20Dt", anchor: "2020-01-01"}}},
+		{name: "two", anchors: "y15=2015-01-01, y24=2024-06-01", want: []econDate{
+			{pre: "y15", corr: "xY15", date: "y15Dt", anchor: "2015-01-01"},
+			{pre: "y24", corr: "xY24", date: "y24Dt", anchor: "2024-06-01"},
+		}},
+		{name: "no date", anchors: "y15", wantErr: true},
+		{name: "upper case", anchors: "Y15=2015-01-01", wantErr: true},
+		{name: "loan date", anchors: "ao=2015-01-01", wantErr: true},
+		{name: "twice", anchors: "y15=2015-01-01, y15=2016-01-01", wantErr: true},
+		{name: "not first of month", anchors: "y15=2015-01-02", wantErr: true},
+		{name: "bad date", anchors: "y15=2015-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs := specsMap{}
+			if tt.anchors != "" {
+				specs["econAnchors"] = tt.anchors
+			}
+
+			got, e := specs.econDates()
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("econDates() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if want := append(append([]econDate{}, loanDates...), tt.want...); !reflect.DeepEqual(got, want) {
+				t.Errorf("econDates() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEconSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		econFields string
+		levels     []string
+		fieldLevel map[string]string
+		wantErr    bool
+	}{
+		{name: "default only", econFields: "zip3", levels: []string{"zip3"}, fieldLevel: map[string]string{}},
+		{name: "field levels", econFields: "zip3, hpi=zip5, unempRate=msa, lbrForceTot=msa",
+			levels:     []string{"zip3", "zip5", "msa"},
+			fieldLevel: map[string]string{"hpi": "zip5", "unempRate": "msa", "lbrForceTot": "msa"}},
+		{name: "empty", econFields: "", wantErr: true},
+		{name: "no default", econFields: "hpi=zip5", wantErr: true},
+		{name: "unknown level", econFields: "zip4", wantErr: true},
+		{name: "unknown field level", econFields: "zip3, hpi=zip4", wantErr: true},
+		{name: "not a field", econFields: "zip3, price=zip5", wantErr: true},
+		{name: "no level", econFields: "zip3, hpi", wantErr: true},
+		{name: "field twice", econFields: "zip3, hpi=zip5, hpi=msa", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, fieldLevel, e := specsMap{"econFields": tt.econFields}.econSpec()
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("econSpec() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(levels, tt.levels) || !reflect.DeepEqual(fieldLevel, tt.fieldLevel) {
+				t.Errorf("econSpec() = %v, %v, want %v, %v", levels, fieldLevel, tt.levels, tt.fieldLevel)
+			}
+		})
+	}
+}
+
+func TestEconFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "none", want: []string{"zip3"}},
+		{name: "chain", fallback: "msa, state, national", want: []string{"zip3", "msa", "state", "national"}},
+		{name: "default level", fallback: "zip3", wantErr: true},
+		{name: "twice", fallback: "msa, msa", wantErr: true},
+		{name: "unknown", fallback: "region", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := specsMap{"econFallback": tt.fallback}.econFallback([]string{"zip3"})
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("econFallback() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("econFallback() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEconLags(t *testing.T) {
+	flds := []econField{{name: "hpi"}, {name: "unempRate"}}
+
+	tests := []struct {
+		name    string
+		lags    string
+		want    map[string]int
+		wantErr bool
+	}{
+		{name: "none", want: map[string]int{}},
+		{name: "two", lags: "hpi=2, unempRate=0", want: map[string]int{"hpi": 2, "unempRate": 0}},
+		{name: "max", lags: "hpi=24", want: map[string]int{"hpi": 24}},
+		{name: "too big", lags: "hpi=25", wantErr: true},
+		{name: "negative", lags: "hpi=-1", wantErr: true},
+		{name: "not a number", lags: "hpi=two", wantErr: true},
+		{name: "no months", lags: "hpi", wantErr: true},
+		{name: "not a field", lags: "price=1", wantErr: true},
+		{name: "twice", lags: "hpi=1, hpi=2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := specsMap{"econLags": tt.lags}.econLags(flds)
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("econLags() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("econLags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEconJoin(t *testing.T) {
+	tests := []struct {
+		name   string
+		specs  specsMap
+		tables []string // names of the econ tables
+		joins  int      // number of joins
+		has    []string // substrings of the query parts
+		hasNot []string
+	}{
+		{
+			name:   "default",
+			specs:  specsMap{"econFields": "zip3"},
+			tables: []string{"tmp.outEconZip3"},
+			joins:  4,
+			has: []string{"b.hpi AS trgHpi", "c.hpi AS aoHpi", "d.hpi AS orgHpi", "toDate('2020-01-01') AS y20Dt",
+				"propVal * (y20Hpi / orgHpi) AS y20PropVal", "b.month = a.trgDt", "LEFT JOIN\n    tmp.outEconZip3 AS b"},
+			hasNot: []string{"multiIf", "econLevel", "Lag"},
+		},
+		{
+			name:   "field level",
+			specs:  specsMap{"econFields": "zip3, unempRate=msa", "econAnchors": "y15=2015-01-01"},
+			tables: []string{"tmp.outEconZip3", "tmp.outEconMsa"},
+			joins:  8,
+			has: []string{"bMsa.unempRate AS trgUnempRate", "b.hpi AS trgHpi", "a.msa = bMsa.msa", "bMsa.month = a.trgDt",
+				"toDate('2015-01-01') AS y15Dt"},
+			hasNot: []string{"multiIf", "y20"},
+		},
+		{
+			name:   "fallback",
+			specs:  specsMap{"econFields": "zip3", "econFallback": "state, national"},
+			tables: []string{"tmp.outEconZip3", "tmp.outEconState", "tmp.outEconNational"},
+			joins:  12,
+			has: []string{"multiIf(b.month = a.trgDt, b.hpi, bState.month = a.trgDt, bState.hpi, bNational.hpi) AS trgHpi",
+				"(b.month = a.trgDt OR bState.month = a.trgDt OR bNational.month = a.trgDt)",
+				"arrayElement(['zip3', 'state', 'national'], arrayMax([",
+				"multiIf(b.month = a.trgDt, 1, bState.month = a.trgDt, 2, bNational.month = a.trgDt, 3, 0)"},
+			hasNot: []string{"a.<geo>", "a. = "},
+		},
+		{
+			name:   "lags",
+			specs:  specsMap{"econFields": "zip3", "econLags": "hpi=2"},
+			tables: []string{"tmp.outEconZip3"},
+			joins:  6,
+			has: []string{"cLag2.hpi AS aoHpi", "dLag2.hpi AS orgHpi", "b.hpi AS trgHpi", "c.unempRate AS aoUnempRate",
+				", addMonths(aoDt, -2) AS aoDtLag2", ", addMonths(fpDt, -2) AS fpDtLag2", "cLag2.month = a.aoDtLag2"},
+			hasNot: []string{"trgDtLag2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.specs["outTable"] = "tmp.out"
+			tt.specs["econDb"] = "econ.all"
+
+			q, e := tt.specs.econJoin()
+			if e != nil {
+				t.Fatalf("econJoin() error = %v", e)
+			}
+
+			names := make([]string, 0)
+			for _, tbl := range q.tables {
+				names = append(names, tbl.name)
+				if !strings.Contains(tbl.query, "econ.all") || strings.Contains(tbl.query, "<econDb>") {
+					t.Errorf("table %s query doesn't read econDb:\n%s", tbl.name, tbl.query)
+				}
+			}
+
+			if !reflect.DeepEqual(names, tt.tables) {
+				t.Errorf("tables = %v, want %v", names, tt.tables)
+			}
+
+			if n := strings.Count(q.joins, "LEFT JOIN"); n != tt.joins {
+				t.Errorf("%d joins, want %d", n, tt.joins)
+			}
+
+			all := strings.Join([]string{q.dates, q.fields, q.joins, q.match}, "\n")
+			for _, s := range tt.has {
+				if !strings.Contains(all, s) {
+					t.Errorf("query doesn't have %q", s)
+				}
+			}
+
+			for _, s := range tt.hasNot {
+				if strings.Contains(all, s) {
+					t.Errorf("query has %q", s)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ require (
 	github.com/invertedv/chutils v1.1.13
 	github.com/invertedv/sampler v0.0.2
 	github.com/invertedv/seafan v0.0.32
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require gonum.org/v1/gonum v0.12.0
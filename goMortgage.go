@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/invertedv/chutils"
 )
 
 const (
@@ -11,6 +19,7 @@ const (
 	maxGroupByDef = 20000000000
 
 	yes = "yes"
+	no  = "no"
 )
 
 // for strconv.ParseInt
@@ -20,62 +29,397 @@ const (
 	bits64 = 64
 )
 
+// exit codes
+const (
+	exitOK    = 0 // run completed
+	exitFail  = 1 // run failed
+	exitUsage = 2 // bad command line or specs file
+	exitNoDb  = 3 // lint: the specs are good but ClickHouse can't be reached to check the tables
+
+	exitInterrupted = 130 // run stopped by SIGINT or SIGTERM
+)
+
+// runOpts holds the command-line options.
+type runOpts struct {
+	specsFile string // .gom file
+
+	args []string // arguments of commands that take them (e.g. the run directories of diff)
+
+	// ClickHouse credentials
+	host string // ClickHouse db
+	user string // ClickHouse username
+	pw   string // password for user
+
+	// ClickHouse options
+	maxMemory  int64
+	maxGroupBy int64
+
+	credsFile string // ClickHouse connection config file
+
+	set map[string]bool // flags set on the command line
+
+	overrides map[string]string // key values that replace those in the specs file (e.g. a sweep variant)
+
+	vars setVars // -set values: keys that replace those in the specs file and values for ${name} references
+
+	// resume a prior run
+	resume bool
+
+	// overwrite a prior run in outDir or resume one whose specs changed
+	force bool
+
+	// minimum level of records written to model.jsonl
+	logLevel logLevel
+
+	// run to use if runs are versioned
+	runID string
+
+	// plan options
+	plan    bool   // render the queries without running them
+	planDir string // directory for the rendered queries
+
+	// lint without checking the tables
+	offline bool
+}
+
+// command is a goMortgage subcommand.
+type command struct {
+	name   string   // name as given on the command line
+	desc   string   // description for the usage message
+	stages []string // stage keys (e.g. buildData) the command sets to yes
+	args   []string // arguments the command takes in place of -specs
+}
+
+// commands are the subcommands goMortgage supports.  Each one runs a single stage regardless of the values of the
+// stage keys in the .gom file.
+var commands = []*command{
+	{name: "data", desc: "build the modeling table (buildData)", stages: []string{"buildData"}},
+	{name: "train", desc: "fit the model (buildModel)", stages: []string{"buildModel"}},
+	{name: "bias", desc: "bias-correct the model (biasCorrect)", stages: []string{"biasCorrect"}},
+	{name: "assess", desc: "assess the model (assessModel)", stages: []string{"assessModel"}},
+	{name: "score", desc: "score scoreQuery and save it to saveTable (scoreModel)", stages: []string{"scoreModel"}},
+	{name: "lint", desc: "check the specs file without running anything", stages: nil},
+	{name: "sweep", desc: "run the variants of a sweep file (-specs is the sweep file)", stages: nil},
+	{name: "convert", desc: "write the .gom specs file as YAML to stdout", stages: nil},
+	{name: "diff", desc: "compare two run directories", stages: nil, args: []string{"<run1>", "<run2>"}},
+}
+
+// stageKeys are the .gom keys that turn on a stage of the run.
+var stageKeys = []string{"buildData", "buildModel", "biasCorrect", "assessModel", "scoreModel"}
+
+// getCommand returns the command called name, nil if there is no such command.
+func getCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+// usageError is an error in how goMortgage was invoked or in the specs file.
+type usageError struct {
+	err error
+}
+
+func (u *usageError) Error() string {
+	return u.err.Error()
+}
+
+func (u *usageError) Unwrap() error {
+	return u.err
+}
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run parses args, runs the requested stages and returns the exit code.
+// If the first argument is a command, only the stage(s) of that command are run. Otherwise, the stages
+// set to yes in the .gom file are run.
+func run(args []string) int {
+	var cmd *command
+	name := "goMortgage"
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if cmd = getCommand(args[0]); cmd == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "goMortgage: unknown command %s\n\n", args[0])
+			usage(os.Stderr)
+			return exitUsage
+		}
+		name = fmt.Sprintf("goMortgage %s", cmd.name)
+		args = args[1:]
+	}
+
+	opts, e := parseFlags(name, cmd, args)
+	if e != nil {
+		if e == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	if e := runStages(ctx, cmd, opts); e != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", name, e)
+		if _, ok := e.(*usageError); ok {
+			return exitUsage
+		}
+
+		if errors.Is(e, errInterrupted) {
+			return exitInterrupted
+		}
+
+		if errors.Is(e, errNoDb) {
+			return exitNoDb
+		}
+
+		return exitFail
+	}
+
+	return exitOK
+}
+
+// parseFlags parses the command-line flags in args.  If cmd takes arguments, they follow the flags and -specs is not
+// required.
+func parseFlags(name string, cmd *command, args []string) (*runOpts, error) {
+	opts := &runOpts{}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		usage(fs.Output())
+		_, _ = fmt.Fprintln(fs.Output(), "\nflags:")
+		fs.PrintDefaults()
+	}
+
 	// modeling options
-	specsFile := flag.String("specs", "", "string")
+	fs.StringVar(&opts.specsFile, "specs", "", "specs (.gom) file")
+	opts.vars = make(setVars)
+	fs.Var(opts.vars, "set", "key=value to replace a key of the specs file, or name=value for ${name} references (may be repeated)")
 
 	// ClickHouse credentials
-	host := flag.String("host", "127.0.0.1", "string") // ClickHouse db
-	user := flag.String("user", "", "string")          // ClickHouse username
-	pw := flag.String("pw", "", "string")              // password for user
+	fs.StringVar(&opts.host, "host", defaultHost, "ClickHouse host")
+	fs.StringVar(&opts.user, "user", "", "ClickHouse user (overrides "+envUser+")")
+	fs.StringVar(&opts.pw, "pw", "", "ClickHouse password (overrides "+envPassword+")")
 
 	// ClickHouse options
-	maxMemory := flag.Int64("memory", maxMemoryDef, "int64")
-	maxGroupby := flag.Int64("groupby", maxGroupByDef, "int64")
+	fs.Int64Var(&opts.maxMemory, "memory", maxMemoryDef, "ClickHouse max_memory_usage")
+	fs.Int64Var(&opts.maxGroupBy, "groupby", maxGroupByDef, "ClickHouse max_bytes_before_external_group_by")
+	fs.StringVar(&opts.credsFile, "creds", "", "ClickHouse connection config file (default $HOME/.goMortgage/connections.json)")
+
+	level := fs.String("logLevel", levelInfo.String(), "minimum level (debug, info, warn, error) written to model.jsonl")
+	fs.BoolVar(&opts.resume, "resume", false, "skip the stages a prior run in outDir completed")
+	fs.StringVar(&opts.runID, "run", "", "run to use when runVersions is yes (default latest)")
+	fs.BoolVar(&opts.force, "force", false, "overwrite a prior run in outDir, or resume one whose specs have changed")
 
-	flag.Parse()
+	// plan options
+	fs.BoolVar(&opts.plan, "plan", false, "write the queries the run would execute without running them")
+	fs.StringVar(&opts.planDir, "planDir", "", "directory for -plan output (default <outDir>plan)")
 
-	specs, conn, log, e := inits(*host, *user, *pw, *specsFile, *maxMemory, *maxGroupby)
+	// lint options
+	fs.BoolVar(&opts.offline, "offline", false, "lint without connecting to ClickHouse to check the tables")
+
+	if e := fs.Parse(args); e != nil {
+		return nil, e
+	}
+
+	opts.set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+
+	if cmd != nil && cmd.args != nil {
+		if fs.NArg() != len(cmd.args) {
+			_, _ = fmt.Fprintf(fs.Output(), "%s: expected arguments %s\n", name, strings.Join(cmd.args, " "))
+			return nil, fmt.Errorf("wrong number of arguments")
+		}
+
+		opts.args = fs.Args()
+	}
+
+	if fs.NArg() > 0 && opts.args == nil {
+		_, _ = fmt.Fprintf(fs.Output(), "%s: unexpected arguments: %s\n", name, strings.Join(fs.Args(), " "))
+		return nil, fmt.Errorf("unexpected arguments")
+	}
+
+	var e error
+	if opts.logLevel, e = parseLevel(*level); e != nil {
+		_, _ = fmt.Fprintf(fs.Output(), "%s: %v\n", name, e)
+		return nil, e
+	}
+
+	if opts.specsFile == "" && opts.args == nil {
+		_, _ = fmt.Fprintf(fs.Output(), "%s: -specs is required\n", name)
+		return nil, fmt.Errorf("missing -specs")
+	}
+
+	return opts, nil
+}
+
+// setVars are the values given by -set flags.
+type setVars map[string]string
+
+// String returns the values as a comma-separated list of name=value.
+func (sv setVars) String() string {
+	vals := make([]string, 0)
+	for name, val := range sv {
+		vals = append(vals, fmt.Sprintf("%s=%s", name, val))
+	}
+	sort.Strings(vals)
+
+	return strings.Join(vals, ",")
+}
+
+// Set adds a value given as name=value.
+func (sv setVars) Set(nameVal string) error {
+	nv := strings.SplitN(nameVal, "=", 2)
+	if len(nv) != 2 || strings.TrimSpace(nv[0]) == "" {
+		return fmt.Errorf("must be name=value, got %s", nameVal)
+	}
+
+	sv[strings.TrimSpace(nv[0])] = nv[1]
+
+	return nil
+}
+
+// flagSet returns true if the flag name was set on the command line.
+func (o *runOpts) flagSet(name string) bool {
+	return o.set[name]
+}
+
+// usage writes the list of commands to w.
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "usage: goMortgage [command] -specs <file.gom> [flags]")
+	_, _ = fmt.Fprintln(w, "       goMortgage diff [flags] <run1> <run2>")
+	_, _ = fmt.Fprintln(w, "\nWith no command, the stages set to yes in the specs file are run.")
+	_, _ = fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		desc := cmd.desc
+		if cmd.args != nil {
+			desc = fmt.Sprintf("%s (%s)", desc, strings.Join(cmd.args, " "))
+		}
+		_, _ = fmt.Fprintf(w, "  %-8s %s\n", cmd.name, desc)
+	}
+}
+
+// runStages initializes the run for cmd and runs its stages.
+func runStages(ctx context.Context, cmd *command, opts *runOpts) (err error) {
+	if cmd != nil && cmd.name == "lint" {
+		return lint(opts)
+	}
+
+	if cmd != nil && cmd.name == "sweep" {
+		return sweep(ctx, opts)
+	}
+
+	if cmd != nil && cmd.name == "convert" {
+		return convert(opts)
+	}
+
+	if cmd != nil && cmd.name == "diff" {
+		return diff(os.Stdout, opts.args[0], opts.args[1])
+	}
+
+	if opts.plan {
+		return plan(opts, cmd)
+	}
+
+	specs, conn, log, e := inits(opts, cmd)
 	if e != nil {
-		panic(e)
+		return e
 	}
+
 	defer func() {
-		if ex := log.Close(); e != nil {
-			panic(ex)
+		if ex := log.Close(); ex != nil && err == nil {
+			err = ex
 		}
 	}()
 	defer func() {
-		if ex := conn.Close(); e != nil {
-			panic(ex)
+		if ex := conn.Close(); ex != nil && err == nil {
+			err = ex
 		}
 	}()
 
 	start := time.Now()
 
-	if specs.buildData() {
-		if e = data(specs, conn, log); e != nil {
-			panic(e)
-		}
+	stages := []struct {
+		name string
+		on   bool
+		run  func(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error
+	}{
+		{"buildData", specs.buildData(), data},
+		{"buildModel", specs.buildModel(), model},
+		{"biasCorrect", specs.biasCorrect(), biasCorrect},
+		{"assessModel", specs.assessModel(), assessModel},
+		{"scoreModel", specs.scoreModel(), score},
 	}
 
-	if specs.buildModel() {
-		if e = model(specs, conn, log); e != nil {
-			panic(e)
+	for _, stage := range stages {
+		if !stage.on {
+			continue
 		}
-	}
 
-	if specs.biasCorrect() {
-		if e = biasCorrect(specs, conn, log); e != nil {
-			panic(e)
+		log.setStage(stage.name)
+		if completed(specs, stage.name, log) {
+			// later stages use the bias-corrected model
+			if stage.name == "biasCorrect" {
+				specs.assign("modelDir", slash(specs.getVal("outDir", true)+specs.getVal("biasDir", true)))
+			}
+			continue
+		}
+
+		// an interrupted stage isn't checkpointed, even if it saved partial output (e.g. the best epoch of a model
+		// fit), so -resume runs it again
+		stageStart := time.Now()
+		e := interrupted(ctx)
+		if e == nil {
+			e = stage.run(ctx, specs, conn, log)
 		}
-	}
 
-	if specs.assessModel() {
-		if e := assessModel(specs, conn, log); e != nil {
-			panic(e)
+		if errors.Is(e, errInterrupted) {
+			log.warn("interrupted", fmt.Sprintf("run interrupted at %s, use -resume to continue", stage.name))
+			_ = checkpointError(specs, e)
+			return e
 		}
+
+		if e != nil {
+			log.error("failed", e)
+			_ = checkpointError(specs, e)
+			return e
+		}
+
+		if e := updateProvenance(specs, func(p *provenance) {
+			p.Timings[stage.name] = time.Since(stageStart).Minutes()
+		}); e != nil {
+			return e
+		}
+
+		if e := checkpoint(specs, stage.name); e != nil {
+			return e
+		}
+	}
+
+	// the run completed, so old runs beyond keepRuns can go
+	if e := specs.pruneRuns(); e != nil {
+		log.warn("keepRuns", fmt.Sprintf("cannot remove old runs: %v", e))
+	}
+
+	log.setStage("")
+	log.end("total", start)
+
+	return nil
+}
+
+// convert writes the .gom file opts.specsFile to stdout as YAML.
+func convert(opts *runOpts) error {
+	if isStructured(opts.specsFile) {
+		return &usageError{fmt.Errorf("%s is not a .gom file", opts.specsFile)}
+	}
+
+	if e := convertGom(opts.specsFile, os.Stdout); e != nil {
+		return &usageError{e}
 	}
 
-	elapsed := time.Since(start).Minutes()
-	logger(log, fmt.Sprintf("total run time: %0.1f minutes", elapsed), true)
+	return nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string // "" for no command
+		args    []string
+		check   func(o *runOpts) bool
+		wantErr bool
+	}{
+		{name: "specs", cmd: "data", args: []string{"-specs", "dq.gom"},
+			check: func(o *runOpts) bool {
+				return o.specsFile == "dq.gom" && o.host == defaultHost && o.maxMemory == maxMemoryDef &&
+					o.logLevel == levelInfo && !o.resume && !o.force && !o.flagSet("host")
+			}},
+		{name: "no command", args: []string{"-specs", "dq.gom", "-resume", "-force", "-run", "r3"},
+			check: func(o *runOpts) bool {
+				return o.resume && o.force && o.runID == "r3" && o.flagSet("resume") && !o.flagSet("plan")
+			}},
+		{name: "set", cmd: "lint", args: []string{"-specs", "dq.gom", "-set", "window=3", "-set", "where1= AND fico>700"},
+			check: func(o *runOpts) bool {
+				return reflect.DeepEqual(o.vars, setVars{"window": "3", "where1": " AND fico>700"})
+			}},
+		{name: "plan", cmd: "data", args: []string{"-specs", "dq.gom", "-plan", "-planDir", "/tmp/plan/"},
+			check: func(o *runOpts) bool {
+				return o.plan && o.planDir == "/tmp/plan/" && o.flagSet("planDir")
+			}},
+		{name: "credentials", cmd: "score", args: []string{"-specs", "dq.gom", "-host", "ch1", "-user", "u", "-pw", "p",
+			"-memory", "100", "-logLevel", "debug"},
+			check: func(o *runOpts) bool {
+				return o.host == "ch1" && o.user == "u" && o.pw == "p" && o.maxMemory == 100 && o.logLevel == levelDebug
+			}},
+		{name: "offline", cmd: "lint", args: []string{"-specs", "dq.gom", "-offline"},
+			check: func(o *runOpts) bool { return o.offline }},
+		{name: "diff args", cmd: "diff", args: []string{"runs/r1", "runs/r2"},
+			check: func(o *runOpts) bool {
+				return o.specsFile == "" && reflect.DeepEqual(o.args, []string{"runs/r1", "runs/r2"})
+			}},
+		{name: "no specs", cmd: "data", args: []string{}, wantErr: true},
+		{name: "unknown flag", cmd: "data", args: []string{"-specs", "dq.gom", "-speed", "1"}, wantErr: true},
+		{name: "bad set", cmd: "data", args: []string{"-specs", "dq.gom", "-set", "window"}, wantErr: true},
+		{name: "bad log level", cmd: "data", args: []string{"-specs", "dq.gom", "-logLevel", "loud"}, wantErr: true},
+		{name: "unexpected args", cmd: "data", args: []string{"-specs", "dq.gom", "extra"}, wantErr: true},
+		{name: "diff one arg", cmd: "diff", args: []string{"runs/r1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd *command
+			if tt.cmd != "" {
+				if cmd = getCommand(tt.cmd); cmd == nil {
+					t.Fatalf("no command %s", tt.cmd)
+				}
+			}
+
+			opts, e := parseFlags("goMortgage", cmd, tt.args)
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("parseFlags(%v) error = %v, wantErr %v", tt.args, e, tt.wantErr)
+			}
+
+			if !tt.wantErr && !tt.check(opts) {
+				t.Errorf("parseFlags(%v) = %+v", tt.args, opts)
+			}
+		})
+	}
+}
+
+func TestParseFlagsHelp(t *testing.T) {
+	if _, e := parseFlags("goMortgage", nil, []string{"-h"}); e != flag.ErrHelp {
+		t.Errorf("parseFlags(-h) error = %v, want flag.ErrHelp", e)
+	}
+}
+
+func TestRunExit(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "lint offline", args: []string{"lint", "-offline", "-specs", "scripts/dq.gom"}, want: exitOK},
+		{name: "lint no ClickHouse", args: []string{"lint", "-host", "127.0.0.1:1", "-specs", "scripts/dq.gom"},
+			want: exitNoDb},
+		{name: "lint bad specs", args: []string{"lint", "-offline", "-specs", "scripts/dq.gom", "-set", "epochs=0"},
+			want: exitUsage},
+		{name: "unknown command", args: []string{"fit", "-specs", "scripts/dq.gom"}, want: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.args); got != tt.want {
+				t.Errorf("run(%v) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
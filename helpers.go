@@ -5,16 +5,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/invertedv/chutils"
 	sea "github.com/invertedv/seafan"
 )
 
-// embed sql into strings
-// BYOD
+// embed sql into strings.  The data sources are in source.go and the econ data is in econ.go.
 var (
 	//go:embed sql/passes/pass1.sql
 	withPass1 string
@@ -25,87 +24,121 @@ var (
 	//go:embed sql/passes/pass3.sql
 	withPass3 string
 
-	//go:embed sql/fannie/mtgFieldsStatic.sql
-	fannieMtgFieldsStat string
+	//go:embed sql/passes/tape.sql
+	withTape string
 
-	//go:embed sql/freddie/mtgFieldsStatic.sql
-	freddieMtgFieldsStat string
+	//go:embed sql/passes/pass3Join.sql
+	withPass3Join string
 
-	//go:embed sql/fannie/mtgFieldsMonthly.sql
-	fannieMtgFieldsMon string
-
-	//go:embed sql/freddie/mtgFieldsMonthly.sql
-	freddieMtgFieldsMon string
-
-	//go:embed sql/fannie/goodloan.sql
-	fannieGoodLoan string
-
-	//go:embed sql/freddie/goodloan.sql
-	freddieGoodLoan string
-
-	//go:embed sql/fannie/pass1Fields.sql
-	fanniePass1 string
-
-	//go:embed sql/freddie/pass1Fields.sql
-	freddiePass1 string
-
-	//go:embed sql/fannie/pass2Fields.sql
-	fanniePass2Fields string
-
-	//go:embed sql/freddie/pass2Fields.sql
-	freddiePass2Fields string
+	// list of all known .gom keys
+	//go:embed strings/keys.txt
+	allKeys string
+)
 
-	//go:embed sql/fannie/pass2FieldsWindow.sql
-	fanniePass2FieldsWindow string
+// loadSpecs reads the specs file, applies the -set values, the overrides and the stages of cmd and checks the result.
+func (o *runOpts) loadSpecs(cmd *command) (*gomFile, error) {
+	gf, e := readSpecsMap(o.specsFile, o.vars)
+	if e != nil {
+		return nil, &usageError{e}
+	}
 
-	//go:embed sql/freddie/pass2FieldsWindow.sql
-	freddiePass2FieldsWindow string
+	if e := gf.setValues(o.vars); e != nil {
+		return nil, &usageError{e}
+	}
 
-	//go:embed sql/fannie/pass3Fields.sql
-	fanniePass3Calcs string
+	keys := make([]string, 0)
+	for key := range o.overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	//go:embed sql/freddie/pass3Fields.sql
-	freddiePass3Calcs string
+	for _, key := range keys {
+		gf.vary(key, o.overrides[key])
+	}
 
-	//go:embed sql/econ/zip3With.sql
-	econTable3 string
+	if cmd != nil {
+		gf.setStages(cmd.stages...)
+	}
 
-	//go:embed sql/econ/zip3Fields.sql
-	econFields3 string
+	// check specs make sense
+	if e := gf.check(); e != nil {
+		return nil, &usageError{e}
+	}
 
-	// list of all known .gom keys
-	//go:embed strings/keys.txt
-	allKeys string
-)
+	return gf, nil
+}
 
-// inits initializes exported vars Specs, Conn, LogFile
-func inits(host, user, pw, specsFile string, maxMemory, maxGroupBy int64) (specsMap, *chutils.Connect, *os.File, error) {
+// inits initializes exported vars Specs, Conn, LogFile.  If cmd is not nil, the stage keys in the specs file are
+// replaced by the stages of cmd.
+func inits(opts *runOpts, cmd *command) (specsMap, *chutils.Connect, *runLog, error) {
 	var e error
 	var modelDir string
 
+	specsFile := opts.specsFile
+
 	sea.Verbose = false
-	conn, e := chutils.NewConnect(host, user, pw, clickhouse.Settings{
-		"max_memory_usage":                   maxMemory,
-		"max_bytes_before_external_group_by": maxGroupBy,
-	})
+
+	gf, e := opts.loadSpecs(cmd)
 	if e != nil {
 		return nil, nil, nil, e
 	}
+	specs := gf.specsMap
 
-	specs, e := readSpecsMap(specsFile)
+	prof, e := specs.connection(opts)
+	if e != nil {
+		return nil, nil, nil, &usageError{e}
+	}
+
+	// connect before touching outDir so an unreachable server leaves the prior run alone.  The connection is closed
+	// if inits fails after this.
+	conn, e := prof.connect()
 	if e != nil {
 		return nil, nil, nil, e
 	}
 
-	// check specs make sense
-	if er := specs.check(); er != nil {
+	ok := false
+	defer func() {
+		if !ok {
+			_ = conn.Close()
+		}
+	}()
+
+	if opts.resume {
+		specs.assign("resume", yes)
+	}
+
+	// if runs are versioned, point outDir to this run's directory
+	if er := specs.setRunDir(opts.runID, true); er != nil {
 		return nil, nil, nil, er
 	}
 
 	outDir := slash(specs.getVal("outDir", true))
-	switch specs.buildData() || specs.buildModel() {
-	case true:
-		// if we're building the data or the model, clean out the outDir
+	switch {
+	case specs.resume():
+		// if we're resuming, keep everything except a partially-built model
+		man, er := loadManifest(outDir)
+		if er != nil {
+			return nil, nil, nil, &usageError{fmt.Errorf("cannot resume, no run manifest in %s", outDir)}
+		}
+
+		if specs.buildModel() && man.stage("buildModel") == nil {
+			if er := os.RemoveAll(outDir + specs.modelKey()); er != nil {
+				return nil, nil, nil, er
+			}
+		}
+
+		if modelDir, e = makeSubDir(outDir, specs.modelKey()); e != nil {
+			return nil, nil, nil, e
+		}
+		specs.assign("modelDir", modelDir)
+
+	case specs.buildData() || specs.buildModel():
+		// if we're building the data or the model, clean out the outDir.  A prior run is only overwritten with -force.
+		if _, er := os.Stat(outDir + manifestFile); er == nil && !opts.force {
+			return nil, nil, nil, &usageError{fmt.Errorf("%s has a prior run: use runVersions: yes to keep it, "+
+				"-resume to continue it or -force to overwrite it", outDir)}
+		}
+
 		if er := os.RemoveAll(outDir); er != nil {
 			return nil, nil, nil, er
 		}
@@ -119,7 +152,7 @@ func inits(host, user, pw, specsFile string, maxMemory, maxGroupBy int64) (specs
 		}
 		specs.assign("modelDir", modelDir)
 
-	case false:
+	default:
 		// otherwise, clean out the graphs directory only
 		specs.assign("modelDir", fmt.Sprintf("%s%s/", outDir, specs.modelKey()))
 
@@ -128,6 +161,11 @@ func inits(host, user, pw, specsFile string, maxMemory, maxGroupBy int64) (specs
 		}
 	}
 
+	warning, e := initManifest(specs, opts.force, specsFile, gf.includes...)
+	if e != nil {
+		return nil, nil, nil, e
+	}
+
 	// create graph directory structure.
 	var graphDir string
 	if graphDir, e = makeSubDir(outDir, specs.graphsKey()); e != nil {
@@ -167,12 +205,12 @@ func inits(host, user, pw, specsFile string, maxMemory, maxGroupBy int64) (specs
 	}
 	specs.assign("inputDir", dir)
 
-	// just doing assessment/bias adjustment ... append to existing log file, don't copy .gom file or input models
+	// just doing assessment/bias adjustment/scoring ... append to existing log file, don't copy .gom file or input models
 	if !specs.buildData() && !specs.buildModel() {
 		// there is already a .gom file, so copy this to the date/time
 		dttm := time.Now().Format("060102150405")
 		toFile := fmt.Sprintf("%s%sdmodel.gom", outDir, dttm)
-		if er := copyFile(specsFile, toFile); er != nil {
+		if er := gf.save(toFile); er != nil {
 			return nil, nil, nil, er
 		}
 
@@ -181,17 +219,27 @@ func inits(host, user, pw, specsFile string, maxMemory, maxGroupBy int64) (specs
 			return nil, nil, nil, er
 		}
 
-		logFile, er := os.OpenFile(outDir+"model.log", os.O_APPEND|os.O_WRONLY, os.ModePerm)
-
+		log, er := newRunLog(outDir, true, opts.logLevel)
 		if er != nil {
 			return nil, nil, nil, er
 		}
 
-		return specs, conn, logFile, nil
+		if warning != "" {
+			log.warn("specs", warning)
+		}
+
+		if er := initProvenance(specs, specsFile, prof.Host, gf.includes...); er != nil {
+			_ = log.Close()
+			return nil, nil, nil, er
+		}
+
+		ok = true
+
+		return specs, conn, log, nil
 	}
 
 	// copy over the spec file
-	if er := copyFile(specsFile, outDir+"model.gom"); er != nil {
+	if er := gf.save(outDir + "model.gom"); er != nil {
 		return nil, nil, nil, er
 	}
 
@@ -200,15 +248,28 @@ func inits(host, user, pw, specsFile string, maxMemory, maxGroupBy int64) (specs
 		return nil, nil, nil, er
 	}
 
+	if er := initProvenance(specs, specsFile, prof.Host, gf.includes...); er != nil {
+		return nil, nil, nil, er
+	}
+
 	// load up required features from inputModels (there will be no model yet in modelDir() but inputModels may be populated)
 	if er := specs.findFeatures(specs.getVal("modelDir", true), true); er != nil {
 		return nil, nil, nil, er
 	}
 
-	// crerate log file
-	logFile, e := os.Create(outDir + "model.log")
+	// crerate log files -- if we're resuming, append to them
+	log, e := newRunLog(outDir, specs.resume(), opts.logLevel)
+	if e != nil {
+		return nil, nil, nil, e
+	}
+
+	if warning != "" {
+		log.warn("specs", warning)
+	}
+
+	ok = true
 
-	return specs, conn, logFile, e
+	return specs, conn, log, nil
 }
 
 // buildQuery builds a query from a skeleton.  Any time the skeleton contains <key>-where key is a key in replacers-
@@ -228,6 +289,15 @@ func buildQuery(baseWith string, replacers map[string]string) string {
 	return fmt.Sprintf("%s SELECT * FROM d", qry)
 }
 
+// capitalize returns name with its first letter in upper case, as in a camel-case name that has a prefix.
+func capitalize(name string) string {
+	if name == "" {
+		return name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
 // slash appends a trailing backslash if there is not one
 func slash(path string) string {
 	if path[len(path)-1:] == "/" {
@@ -296,7 +366,11 @@ func makeSubDir(dir, subDir string) (path string, err error) {
 	path = slash(dir) + slash(subDir)
 
 	if _, err = os.Stat(path); os.IsNotExist(err) {
-		err = os.Mkdir(slash(dir)+subDir, os.ModePerm)
+		// it may have been made since the Stat
+		if err = os.Mkdir(slash(dir)+subDir, os.ModePerm); os.IsExist(err) {
+			err = nil
+		}
+
 		return
 	}
 
@@ -361,14 +435,6 @@ func toSlice(str, sep string) []string {
 	return strings.Split(str, sep)
 }
 
-// logger makes a log entry.
-func logger(log *os.File, text string, toConsole bool) {
-	_, _ = fmt.Fprintln(log, text)
-	if toConsole {
-		fmt.Println(text)
-	}
-}
-
 // inModel determines whether the feature is in the input statement from a sea.ModSpec
 func inModel(input, feature string) bool {
 	const minLen = 5 // "input" has 5 letters
@@ -406,7 +472,7 @@ func checkKey(key string, possible []string) (ok bool) {
 		}
 		if strings.Contains(poss, "*") {
 			root := strings.ReplaceAll(poss, "*", "")
-			if strings.Contains(key, root) {
+			if strings.HasPrefix(key, root) {
 				return true
 			}
 		}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// refPattern matches a ${name} reference in a .gom value.
+var refPattern = regexp.MustCompile(`\$\{([^}]*)}`)
+
+// interpolate replaces the ${name} references in the values of the .gom file.  name is, in order of precedence:
+//   - a value given on the command line with -set name=value (vars);
+//   - another key of the .gom file, after the files it includes are merged;
+//   - an environment variable.
+//
+// References to keys are replaced recursively.  Undefined references and cycles are errors.
+func (gf *gomFile) interpolate(vars map[string]string) error {
+	errs := make(specErrors, 0)
+	done := make(map[string]bool)
+
+	var resolve func(key string, stack []string)
+	resolve = func(key string, stack []string) {
+		if done[key] {
+			return
+		}
+
+		stack = append(stack, key)
+		val := refPattern.ReplaceAllStringFunc(gf.specsMap[key], func(ref string) string {
+			name := strings.TrimSpace(ref[2 : len(ref)-1])
+
+			if v, ok := vars[name]; ok {
+				gf.refs[name] = true
+				return v
+			}
+
+			if _, ok := gf.specsMap[name]; ok {
+				if ind := searchSlice(name, stack); ind >= 0 {
+					errs = append(errs, gf.errorf(key, "reference cycle %s -> %s", strings.Join(stack[ind:], " -> "), name))
+					return ref
+				}
+
+				resolve(name, stack)
+
+				return gf.specsMap[name]
+			}
+
+			if v, ok := os.LookupEnv(name); ok {
+				return v
+			}
+
+			errs = append(errs, gf.errorf(key, "undefined reference %s", ref))
+
+			return ref
+		})
+
+		if val != gf.specsMap[key] {
+			gf.specsMap[key], gf.asRead[key] = val, val
+			gf.expanded = true
+		}
+
+		done[key] = true
+	}
+
+	for _, key := range gf.keys() {
+		resolve(key, nil)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// setValues applies the values given on the command line with -set name=value (vars).  If name is a key, the value
+// replaces the value of the key in the .gom file, or adds the key.  Other values must be used by a ${name}
+// reference.
+func (gf *gomFile) setValues(vars map[string]string) error {
+	known := strings.Split(strings.ReplaceAll(allKeys, "\n", ""), ",")
+
+	names := make([]string, 0)
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make(specErrors, 0)
+	for _, name := range names {
+		switch {
+		case checkKey(name, known):
+			gf.override(name, vars[name])
+		case !gf.refs[name]:
+			errs = append(errs, fmt.Errorf("-set %s: not a key and not used by a ${%s} reference", name, name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
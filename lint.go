@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/invertedv/chutils"
+)
+
+// keyStages are the stages that use each key.  The key may end in a wildcard.  Keys not listed here are general
+// (e.g. outDir, title) or describe the model, which most stages use.
+var keyStages = map[string][]string{
+	"strats1":           {"buildData"},
+	"sampleSize1":       {"buildData"},
+	"pass1Strat":        {"buildData"},
+	"pass1Sample":       {"buildData"},
+	"strats2":           {"buildData"},
+	"sampleSize2":       {"buildData"},
+	"pass2Strat":        {"buildData"},
+	"pass2Sample":       {"buildData"},
+	"mtgDb":             {"buildData"},
+	"mtgFields":         {"buildData"},
+	"tapeFile":          {"buildData"},
+	"tapeMap":           {"buildData"},
+	"econDb":            {"buildData"},
+	"econFields":        {"buildData"},
+	"econFallback":      {"buildData"},
+	"econAnchors":       {"buildData"},
+	"econLags":          {"buildData"},
+	"econSql":           {"buildData"},
+	"outTable":          {"buildData"},
+	"where1":            {"buildData"},
+	"where2":            {"buildData"},
+	"window":            {"buildData"},
+	"tableKey":          {"buildData"},
+	"layer*":            {"buildModel"},
+	"epochs":            {"buildModel"},
+	"batchSize":         {"buildModel"},
+	"modelQuery":        {"buildModel"},
+	"learningRate":      {"buildModel"},
+	"learningRateStart": {"buildModel"},
+	"learningRateEnd":   {"buildModel"},
+	"validateQuery":     {"buildModel"},
+	"earlyStopping":     {"buildModel"},
+	"l2Reg":             {"buildModel"},
+	"startFrom":         {"buildModel"},
+	"biasQuery":         {"biasCorrect"},
+	"assessQuery":       {"assessModel"},
+	"assessName*":       {"assessModel"},
+	"assessTarget*":     {"assessModel"},
+	"assessSlicer*":     {"assessModel"},
+	"curvesName*":       {"assessModel"},
+	"curvesTarget*":     {"assessModel"},
+	"curvesSlicer*":     {"assessModel"},
+	"assessAddl":        {"assessModel"},
+	"assessWorkers":     {"assessModel"},
+	"scoreQuery":        {"scoreModel"},
+	"saveTable":         {"assessModel", "scoreModel"},
+	"saveTableTargets":  {"assessModel", "scoreModel"},
+	"addlKeep":          {"assessModel", "scoreModel"},
+	"group*":            {"assessModel", "scoreModel"},
+}
+
+// queryStages are the queries each stage runs.
+var queryStages = map[string][]string{
+	"buildModel":  {"modelQuery", "validateQuery"},
+	"biasCorrect": {"biasQuery"},
+	"assessModel": {"assessQuery"},
+	"scoreModel":  {"scoreQuery"},
+}
+
+// fromPattern finds the table a query reads.
+var fromPattern = regexp.MustCompile(`(?i)\bFROM\s+([A-Za-z_][\w.]*)`)
+
+// errNoDb is returned by lint if the specs are good but ClickHouse can't be reached to check the tables.
+var errNoDb = errors.New("tables not checked")
+
+// lint reads and checks the specs file.  Beyond the checks every run makes, lint reports keys that are not used by
+// the stages that run and checks the specs against the tables the queries read.  With -offline, the tables are not
+// checked.  Nothing is run.
+func lint(opts *runOpts) error {
+	gf, e := opts.loadSpecs(nil)
+	if e != nil {
+		return e
+	}
+
+	for _, w := range gf.unused() {
+		fmt.Printf("warning: %s\n", w)
+	}
+
+	if opts.offline {
+		fmt.Printf("%s: ok (tables not checked)\n", opts.specsFile)
+
+		return nil
+	}
+
+	prof, e := gf.connection(opts)
+	if e != nil {
+		return &usageError{e}
+	}
+
+	conn, e := prof.connect()
+	if e != nil {
+		return fmt.Errorf("%w, cannot connect to ClickHouse (use -offline to skip them): %v", errNoDb, e)
+	}
+	defer func() { _ = conn.Close() }()
+
+	errs := append(gf.checkTables(conn), gf.checkEconTables(conn)...)
+	if len(errs) > 0 {
+		return &usageError{errs}
+	}
+
+	fmt.Printf("%s: ok\n", opts.specsFile)
+
+	return nil
+}
+
+// stagesOf returns the stages that use key, nil if every stage does.
+func stagesOf(key string) []string {
+	if stages, ok := keyStages[key]; ok {
+		return stages
+	}
+
+	for name, stages := range keyStages {
+		if strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*")) {
+			return stages
+		}
+	}
+
+	return nil
+}
+
+// unused returns a warning for the keys that none of the stages that run use.  There is one warning for each set of
+// stages.
+func (gf *gomFile) unused() []string {
+	order := make([]string, 0)
+	keys := make(map[string][]string)
+
+	for _, key := range gf.keys() {
+		stages := stagesOf(key)
+		if stages == nil {
+			continue
+		}
+
+		used := false
+		for _, stage := range stages {
+			used = used || gf.specsMap[stage] == yes
+		}
+
+		if used {
+			continue
+		}
+
+		by := strings.Join(stages, "/")
+		if _, ok := keys[by]; !ok {
+			order = append(order, by)
+		}
+		keys[by] = append(keys[by], key)
+	}
+
+	warns := make([]string, 0)
+	for _, by := range order {
+		warns = append(warns, fmt.Sprintf("%s: %s not run, these keys are not used: %s", gf.name, by,
+			strings.Join(keys[by], ", ")))
+	}
+
+	return warns
+}
+
+// checkTables checks the specs against the tables the queries of the stages read:
+//   - the fields the queries select are in the table;
+//   - if the target is categorical, the last layer of the model has one output for each level of the target in the
+//     model data.
+//
+// Tables that the run builds are not checked.
+func (gf *gomFile) checkTables(conn *chutils.Connect) specErrors {
+	errs := make(specErrors, 0)
+	sf := gf.specsMap
+
+	// queryFields leaves out the fields from input models, which are calculated
+	fields := make([]string, 0)
+	for _, fld := range sf.queryFields() {
+		if fld != "" {
+			fields = append(fields, fld)
+		}
+	}
+
+	schemas := make(map[string]map[string]bool)
+
+	for _, stage := range stageKeys {
+		if sf[stage] != yes {
+			continue
+		}
+
+		for _, key := range queryStages[stage] {
+			qry, ok := sf[key]
+			if !ok {
+				continue
+			}
+
+			m := fromPattern.FindStringSubmatch(qry)
+			if m == nil {
+				fmt.Printf("warning: %v\n", gf.errorf(key, "cannot find the table the query reads, not checked"))
+				continue
+			}
+
+			table := m[1]
+			if sf.buildData() && table == sf["outTable"] {
+				continue
+			}
+
+			if _, ok := schemas[table]; !ok {
+				cols, e := describe(conn, table)
+				if e != nil {
+					errs = append(errs, gf.errorf(key, "%v", e))
+					continue
+				}
+
+				schemas[table] = cols
+			}
+
+			for _, fld := range fields {
+				if !schemas[table][fld] {
+					errs = append(errs, gf.errorf(key, "field %s is not in table %s", fld, table))
+				}
+			}
+		}
+	}
+
+	// the levels of the target are counted in the model data
+	layer, size, activation := gf.lastLayer()
+	if sf["targetType"] != "cat" || size == 0 || activation != "softmax" || !sf.buildModel() || len(errs) > 0 {
+		return errs
+	}
+
+	if m := fromPattern.FindStringSubmatch(sf["modelQuery"]); m == nil || (sf.buildData() && m[1] == sf["outTable"]) {
+		return errs
+	}
+
+	var levels uint64
+	qry := fmt.Sprintf("SELECT uniqExact(%s) FROM (%s)", sf["target"], fmt.Sprintf(sf["modelQuery"], sf["target"]))
+	if e := conn.QueryRow(qry).Scan(&levels); e != nil {
+		return append(errs, gf.errorf("modelQuery", "cannot count the levels of %s: %v", sf["target"], e))
+	}
+
+	if int(levels) != size {
+		errs = append(errs, gf.errorf(layer, "the target %s has %d levels in the model data, the last layer has size %d",
+			sf["target"], levels, size))
+	}
+
+	return errs
+}
+
+// checkEconTables checks that econDb has what the WITH statements of the econ levels that pass 3 joins need:
+//   - the geo field each level joins on;
+//   - the columns each WITH statement reads (e.g. zip5Hpi for zip5), found by running it with LIMIT 0;
+//   - each WITH statement returns the geo field, month, msaNameLoc and the fields of the econ field list.
+//
+// Nothing is checked if buildData is not run.
+func (gf *gomFile) checkEconTables(conn *chutils.Connect) specErrors {
+	errs := make(specErrors, 0)
+	sf := gf.specsMap
+
+	if !sf.buildData() {
+		return errs
+	}
+
+	levels, _, e := sf.econSpec()
+	if e != nil {
+		return append(errs, gf.errorf("econFields", "%v", e))
+	}
+
+	chain, e := sf.econFallback(levels)
+	if e != nil {
+		return append(errs, gf.errorf("econFallback", "%v", e))
+	}
+
+	flds, e := sf.econFieldList()
+	if e != nil {
+		return append(errs, gf.errorf("econFields", "%v", e))
+	}
+
+	cols, e := describe(conn, sf["econDb"])
+	if e != nil {
+		return append(errs, gf.errorf("econDb", "%v", e))
+	}
+
+	for ind, level := range append(levels, chain[1:]...) {
+		key := "econFields"
+		if ind >= len(levels) {
+			key = "econFallback"
+		}
+
+		geo := econLevels[level].geo
+		if geo != "" && !cols[geo] {
+			errs = append(errs, gf.errorf(key, "level %s joins on %s, which econDb %s doesn't have", level, geo,
+				sf["econDb"]))
+			continue
+		}
+
+		tbl, e := sf.econLevelTable(level)
+		if e != nil {
+			errs = append(errs, gf.errorf(key, "level %s: %v", level, e))
+			continue
+		}
+
+		out, e := queryColumns(conn, tbl.query)
+		if e != nil {
+			errs = append(errs, gf.errorf(key, "level %s: %s fails on econDb %s: %v", level,
+				econLevels[level].file, sf["econDb"], e))
+			continue
+		}
+
+		need := []string{"month", "msaNameLoc"}
+		if geo != "" {
+			need = append(need, geo)
+		}
+
+		for _, fld := range flds {
+			need = append(need, fld.name)
+		}
+
+		for _, col := range need {
+			if !out[col] {
+				errs = append(errs, gf.errorf(key, "level %s: %s doesn't return %s", level, econLevels[level].file, col))
+			}
+		}
+	}
+
+	return errs
+}
+
+// queryColumns returns the columns qry returns.  The query is run with LIMIT 0, so no data is read.
+func queryColumns(conn *chutils.Connect, qry string) (map[string]bool, error) {
+	rows, e := conn.Query(fmt.Sprintf("SELECT * FROM (%s) LIMIT 0", qry))
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = rows.Close() }()
+
+	names, e := rows.Columns()
+	if e != nil {
+		return nil, e
+	}
+
+	cols := make(map[string]bool)
+	for _, name := range names {
+		cols[name] = true
+	}
+
+	return cols, rows.Err()
+}
+
+// describe returns the columns of table.
+func describe(conn *chutils.Connect, table string) (map[string]bool, error) {
+	rows, e := conn.Query(fmt.Sprintf("DESCRIBE TABLE %s", table))
+	if e != nil {
+		return nil, fmt.Errorf("cannot describe table %s: %v", table, e)
+	}
+	defer func() { _ = rows.Close() }()
+
+	types, e := rows.ColumnTypes()
+	if e != nil {
+		return nil, e
+	}
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		vals := make([]any, len(types))
+		name := ""
+		vals[0] = &name
+
+		for ind := 1; ind < len(vals); ind++ {
+			vals[ind] = new(string)
+		}
+
+		if e := rows.Scan(vals...); e != nil {
+			return nil, e
+		}
+
+		cols[name] = true
+	}
+
+	return cols, rows.Err()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// logLevel is the severity of a log record
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string {
+	return levelNames[l]
+}
+
+// MarshalJSON writes the level as its name.
+func (l logLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// parseLevel returns the logLevel named name.
+func parseLevel(name string) (logLevel, error) {
+	for ind, lvl := range levelNames {
+		if strings.EqualFold(name, lvl) {
+			return logLevel(ind), nil
+		}
+	}
+
+	return levelInfo, fmt.Errorf("unknown log level %s, must be one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// logRecord is one line of the JSON log.
+type logRecord struct {
+	Time    time.Time      `json:"time"`
+	Level   logLevel       `json:"level"`
+	Stage   string         `json:"stage,omitempty"`   // stage being run (e.g. buildModel)
+	Event   string         `json:"event"`             // what happened (e.g. start, end, metric)
+	Metric  string         `json:"metric,omitempty"`  // metric name (e.g. ks)
+	Value   *float64       `json:"value,omitempty"`   // metric value
+	Minutes *float64       `json:"minutes,omitempty"` // duration
+	Attrs   map[string]any `json:"attrs,omitempty"`   // additional detail (e.g. the assessment a KS is for)
+	Msg     string         `json:"msg,omitempty"`     // human-readable text
+}
+
+// runLog logs the run.  Every record is written as text to model.log and, if at or above level, as a JSON line to
+// model.jsonl.  Records may also be echoed to the console.
+type runLog struct {
+	text  *os.File // human-readable log
+	json  *os.File // JSON-lines log
+	level logLevel // minimum level written to the JSON log
+	stage string   // current stage
+	held  []*held  // records held by a buffered log
+}
+
+// held is a record held by a buffered log until it is flushed.
+type held struct {
+	rec       *logRecord
+	toConsole bool
+}
+
+// newRunLog opens model.log and model.jsonl in outDir.  If appendTo is true, the logs are appended to.
+func newRunLog(outDir string, appendTo bool, level logLevel) (*runLog, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendTo {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	text, e := os.OpenFile(outDir+"model.log", flags, 0644)
+	if e != nil {
+		return nil, e
+	}
+
+	jsn, e := os.OpenFile(outDir+"model.jsonl", flags, 0644)
+	if e != nil {
+		_ = text.Close()
+		return nil, e
+	}
+
+	return &runLog{text: text, json: jsn, level: level}, nil
+}
+
+// Close closes the log files.
+func (l *runLog) Close() error {
+	e := l.text.Close()
+	if ej := l.json.Close(); e == nil {
+		e = ej
+	}
+
+	return e
+}
+
+// buffered returns a log that holds its records until flush is called.  Work done in parallel logs to
+// its own buffered log so that the records can be written in a fixed order.
+func (l *runLog) buffered() *runLog {
+	return &runLog{level: l.level, stage: l.stage, held: make([]*held, 0)}
+}
+
+// flush writes the records held by the buffered log l to to.
+func (l *runLog) flush(to *runLog) {
+	for _, h := range l.held {
+		to.write(h.rec, h.toConsole)
+	}
+
+	l.held = l.held[:0]
+}
+
+// setStage sets the stage for subsequent records.
+func (l *runLog) setStage(stage string) {
+	l.stage = stage
+}
+
+// write makes a log entry.
+func (l *runLog) write(rec *logRecord, toConsole bool) {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+		rec.Stage = l.stage
+	}
+
+	if l.held != nil {
+		l.held = append(l.held, &held{rec: rec, toConsole: toConsole})
+		return
+	}
+
+	_, _ = fmt.Fprintln(l.text, rec.Msg)
+	if toConsole {
+		fmt.Println(rec.Msg)
+	}
+
+	if rec.Level < l.level {
+		return
+	}
+
+	// the text may have blank lines for readability in model.log
+	rec.Msg = strings.TrimSpace(rec.Msg)
+	buf, e := json.Marshal(rec)
+	if e != nil {
+		buf = fallbackRecord(rec, e)
+	}
+
+	_, _ = fmt.Fprintln(l.json, string(buf))
+}
+
+// fallbackRecord returns the JSON of rec when rec can't be marshaled (e.g. a NaN metric).  The value, duration and
+// attrs are written as text along with the error.
+func fallbackRecord(rec *logRecord, err error) []byte {
+	attrs := map[string]any{"marshalError": err.Error()}
+	if rec.Value != nil {
+		attrs["value"] = fmt.Sprint(*rec.Value)
+	}
+
+	if rec.Minutes != nil {
+		attrs["minutes"] = fmt.Sprint(*rec.Minutes)
+	}
+
+	for k, v := range rec.Attrs {
+		attrs[k] = fmt.Sprint(v)
+	}
+
+	buf, _ := json.Marshal(&logRecord{Time: rec.Time, Level: rec.Level, Stage: rec.Stage, Event: rec.Event,
+		Metric: rec.Metric, Attrs: attrs, Msg: rec.Msg})
+
+	return buf
+}
+
+// debug logs detail, such as pipeline summaries, that isn't echoed to the console.
+func (l *runLog) debug(event, text string) {
+	l.write(&logRecord{Level: levelDebug, Event: event, Msg: text}, false)
+}
+
+// info logs event.
+func (l *runLog) info(event, text string, toConsole bool) {
+	l.write(&logRecord{Level: levelInfo, Event: event, Msg: text}, toConsole)
+}
+
+// warn logs a warning.  Warnings are always echoed to the console.
+func (l *runLog) warn(event, text string) {
+	l.write(&logRecord{Level: levelWarn, Event: event, Msg: text}, true)
+}
+
+// error logs an error.  Errors are not echoed to the console, the caller reports them.
+func (l *runLog) error(event string, err error) {
+	l.write(&logRecord{Level: levelError, Event: event, Msg: fmt.Sprintf("run %s: %v", event, err)}, false)
+}
+
+// metric logs the value of the metric name.
+func (l *runLog) metric(name string, value float64, attrs map[string]any, text string, toConsole bool) {
+	l.write(&logRecord{Level: levelInfo, Event: "metric", Metric: name, Value: &value, Attrs: attrs, Msg: text},
+		toConsole)
+}
+
+// start logs the start of a stage.
+func (l *runLog) start(what string, start time.Time) {
+	l.info("start", fmt.Sprintf("starting %s @ %s", what, start.Format(time.UnixDate)), true)
+}
+
+// end logs the end of a stage along with its run time.
+func (l *runLog) end(what string, start time.Time) {
+	minutes := time.Since(start).Minutes()
+	l.write(&logRecord{Level: levelInfo, Event: "end", Minutes: &minutes,
+		Msg: fmt.Sprintf("%s run time: %0.1f minutes", what, minutes)}, true)
+}
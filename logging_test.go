@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   func(l *runLog)
+		want  map[string]any // fields of the JSON record
+		attrs map[string]any // attrs of the JSON record
+	}{
+		{name: "metric", log: func(l *runLog) { l.metric("ks", 0.5, map[string]any{"slice": "fico"}, "KS", false) },
+			want: map[string]any{"event": "metric", "metric": "ks", "value": 0.5}, attrs: map[string]any{"slice": "fico"}},
+		{name: "NaN metric", log: func(l *runLog) { l.metric("ks", math.NaN(), map[string]any{"n": 3}, "KS", false) },
+			want:  map[string]any{"event": "metric", "metric": "ks", "msg": "KS"},
+			attrs: map[string]any{"value": "NaN", "n": "3", "marshalError": "unsupported value: NaN"}},
+		{name: "info", log: func(l *runLog) { l.info("fit", "done", false) },
+			want: map[string]any{"event": "fit", "msg": "done", "level": "info"}},
+		{name: "bad attr", log: func(l *runLog) { l.metric("auc", 1, map[string]any{"cost": math.Inf(1)}, "AUC", false) },
+			want:  map[string]any{"event": "metric", "metric": "auc"},
+			attrs: map[string]any{"value": "1", "cost": "+Inf", "marshalError": "unsupported value"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			l, e := newRunLog(dir, false, levelDebug)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			tt.log(l)
+			if e := l.Close(); e != nil {
+				t.Fatal(e)
+			}
+
+			buf, e := os.ReadFile(dir + "model.jsonl")
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			rec := make(map[string]any)
+			if e := json.Unmarshal(buf, &rec); e != nil {
+				t.Fatalf("model.jsonl = %q: %v", buf, e)
+			}
+
+			for k, v := range tt.want {
+				if rec[k] != v {
+					t.Errorf("%s = %v, want %v", k, rec[k], v)
+				}
+			}
+
+			attrs, _ := rec["attrs"].(map[string]any)
+			for k, v := range tt.attrs {
+				got, _ := attrs[k].(string)
+				if want, ok := v.(string); ok && k == "marshalError" {
+					if !strings.Contains(got, want) {
+						t.Errorf("attrs[%s] = %q, want %q", k, got, want)
+					}
+
+					continue
+				}
+
+				if attrs[k] != v {
+					t.Errorf("attrs[%s] = %v, want %v", k, attrs[k], v)
+				}
+			}
+		})
+	}
+}
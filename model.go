@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -77,8 +77,31 @@ func getFts(specs specsMap) (sea.FTypes, error) {
 	return nil, nil
 }
 
-// model is the core model-building function.
-func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
+// costs returns the cost function values at the best and final epochs.
+func costs(fit *sea.Fit) *fitCosts {
+	fc := &fitCosts{}
+	best := fit.BestEpoch() - 1 // epochs start at 1
+
+	if in := fit.InCosts(); in != nil && len(in.Y) > 0 {
+		fc.ModelFinal = in.Y[len(in.Y)-1]
+		if best >= 0 && best < len(in.Y) {
+			fc.ModelBest = in.Y[best]
+		}
+	}
+
+	if out := fit.OutCosts(); out != nil && len(out.Y) > 0 {
+		fc.ValidationFinal = out.Y[len(out.Y)-1]
+		if best >= 0 && best < len(out.Y) {
+			fc.ValidationBest = out.Y[best]
+		}
+	}
+
+	return fc
+}
+
+// model is the core model-building function.  If the run is interrupted, the fit stops after the current epoch and the
+// best model so far is kept.
+func model(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
 	var (
 		e                  error
 		modelPipe, valPipe sea.Pipeline
@@ -86,7 +109,7 @@ func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
 	)
 
 	start := time.Now()
-	logger(log, fmt.Sprintf("starting model build @ %s", start.Format(time.UnixDate)), true)
+	log.start("model build", start)
 
 	batchSize, e := specs.batchSize()
 	if e != nil {
@@ -109,7 +132,11 @@ func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
-	logger(log, fmt.Sprintf("%v", modelPipe), false)
+	log.debug("pipeline", fmt.Sprintf("%v", modelPipe))
+
+	if er := provenanceRows(specs, "model", specs.getQuery("model"), modelPipe.Rows()); er != nil {
+		return er
+	}
 
 	// add defaults and restrict fts to features defined in specs append(specs.allCat(), specs.ctsFeatures()...)
 	if fts, e = addDefault(modelPipe, append(specs.allCts(), specs.allCat()...)); e != nil {
@@ -126,15 +153,16 @@ func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		return e
 	}
 
-	logger(log, fmt.Sprintf("\n\n%v", nnModel), true)
+	log.info("model", fmt.Sprintf("\n\n%v", nnModel), true)
 
 	startLR, endLR, e := specs.learnRate()
 	if e != nil {
 		return e
 	}
 
-	// model fit struct
-	fit := sea.NewFit(nnModel, epochs, modelPipe,
+	// model fit struct.  The fit sees modelPipe through stopPipe, so it can be interrupted.
+	stop := &stopPipe{Pipeline: modelPipe, ctx: ctx}
+	fit := sea.NewFit(nnModel, epochs, stop,
 		sea.WithLearnRate(startLR, endLR),
 		sea.WithOutFile(specs.modelRoot()))
 
@@ -143,7 +171,11 @@ func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		if valPipe, e = newPipe(specs.getQuery("validate"), "Validation data", specs, 0, fts, conn); e != nil {
 			return e
 		}
-		logger(log, fmt.Sprintf("\n\n%v", valPipe), false)
+		log.debug("pipeline", fmt.Sprintf("\n\n%v", valPipe))
+
+		if er := provenanceRows(specs, "validate", valQry, valPipe.Rows()); er != nil {
+			return er
+		}
 
 		earlyStopping, ex := specs.earlyStopping()
 		if ex != nil {
@@ -151,6 +183,10 @@ func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
 		}
 
 		sea.WithValidation(valPipe, earlyStopping)(fit)
+
+		// the epochs skipped after an interruption don't improve the validation cost, so early stopping ends the fit
+		// after one of them rather than finding the validation cost of each
+		stop.onStop = func() { sea.WithValidation(valPipe, 1)(fit) }
 	}
 
 	// see if there is L2 regularization
@@ -169,14 +205,32 @@ func model(specs specsMap, conn *chutils.Connect, log *os.File) error {
 
 	sea.Verbose = false
 
+	if stop.stopped {
+		// the best epoch so far is saved in modelDir, but the stage isn't complete, so -resume trains again
+		if fit.BestEpoch() > 0 {
+			log.warn("interrupted", fmt.Sprintf("model fit interrupted, best epoch %d saved to %s",
+				fit.BestEpoch(), specs.modelRoot()))
+		}
+
+		return errInterrupted
+	}
+
 	if e := plotCosts(fit, nnModel.Cost().Name(), specs); e != nil {
 		return e
 	}
 
-	logger(log, fmt.Sprintf("\n\nBest Epoch: %d", fit.BestEpoch()), true)
+	fc := costs(fit)
+	log.metric("bestEpoch", float64(fit.BestEpoch()), map[string]any{"modelCost": fc.ModelBest,
+		"validationCost": fc.ValidationBest}, fmt.Sprintf("\n\nBest Epoch: %d", fit.BestEpoch()), true)
+
+	if e := updateProvenance(specs, func(p *provenance) {
+		p.BestEpoch = fit.BestEpoch()
+		p.Costs = fc
+	}); e != nil {
+		return e
+	}
 
-	elapsed := time.Since(start).Minutes()
-	logger(log, fmt.Sprintf("model build run time: %0.1f minutes", elapsed), true)
+	log.end("model build", start)
 
 	return nil
 }
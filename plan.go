@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sea "github.com/invertedv/seafan"
+)
+
+// plan renders every query the run would execute without connecting to ClickHouse.
+// The queries are written as .sql files to planDir along with summary.txt, which lists the stages that would run
+// and the tables they would read and create.
+//
+// The per-level marginal queries require the levels of the slicer.  These are available only if the model
+// already exists (e.g. an assessment-only run).  Otherwise, the marginal query is written with the placeholder
+// <level>.
+func plan(opts *runOpts, cmd *command) error {
+	gf, e := opts.loadSpecs(cmd)
+	if e != nil {
+		return e
+	}
+	specs := gf.specsMap
+
+	// resolve the run directory of an existing run. The directory of a new run isn't created by a plan.
+	if !specs.buildData() && !specs.buildModel() {
+		if er := specs.setRunDir(opts.runID, false); er != nil {
+			return er
+		}
+	}
+
+	outDir := specs.getVal("outDir", true)
+	planDir := opts.planDir
+	if planDir == "" {
+		planDir = outDir + "plan"
+	}
+	planDir = slash(planDir)
+
+	if er := clearPlan(planDir); er != nil {
+		return er
+	}
+
+	if er := os.MkdirAll(planDir, os.ModePerm); er != nil {
+		return er
+	}
+
+	specs.assign("modelDir", fmt.Sprintf("%s%s/", outDir, specs.modelKey()))
+
+	// resolve the features from the existing model or, if we're building the model, from the input models
+	building := specs.buildData() || specs.buildModel()
+	switch building {
+	case true:
+		for k, v := range specs {
+			if !strings.Contains(k, "inputModel") {
+				continue
+			}
+
+			if er := specs.findFeatures(slash(specs.getVal("location"+v, true)), false); er != nil {
+				return er
+			}
+		}
+	case false:
+		if er := specs.findFeatures(specs.getVal("modelDir", true), true); er != nil {
+			return er
+		}
+	}
+
+	summary := &strings.Builder{}
+	_, _ = fmt.Fprintf(summary, "plan for %s\n\n", opts.specsFile)
+
+	if specs.buildData() {
+		_, _ = fmt.Fprintln(summary, "buildData")
+		if specs.loadsTape() {
+			qry, er := tapeQuery(specs)
+			if er != nil {
+				return er
+			}
+
+			if er := writePlan(planDir, "tape.sql", qry); er != nil {
+				return er
+			}
+
+			_, _ = fmt.Fprintf(summary, "  reads  %s\n", specs.getVal("tapeFile", true))
+			for _, table := range specs.tapeTables() {
+				_, _ = fmt.Fprintf(summary, "  creates %s (tapeFile)\n", table)
+			}
+		}
+
+		qry1, er := pass1Query(specs)
+		if er != nil {
+			return er
+		}
+
+		qry2, er := pass2Query(specs)
+		if er != nil {
+			return er
+		}
+
+		qry3, econ, er := pass3Query(specs)
+		if er != nil {
+			return er
+		}
+
+		// the econ tables pass 3 builds first
+		for _, tbl := range econ {
+			name := "econ" + strings.TrimPrefix(tbl.name, specs.getVal("outTable", true)+"Econ") + ".sql"
+			if er := writePlan(planDir, name, tbl.query); er != nil {
+				return er
+			}
+		}
+
+		for ind, qry := range []string{qry1, qry2, qry3} {
+			if er := writePlan(planDir, fmt.Sprintf("pass%d.sql", ind+1), qry); er != nil {
+				return er
+			}
+		}
+
+		_, _ = fmt.Fprintf(summary, "  reads  %s\n", specs.getVal("mtgDb", true))
+		_, _ = fmt.Fprintf(summary, "  reads  %s\n", specs.getVal("econDb", true))
+		for _, table := range []string{"pass1Strat", "pass1Sample", "pass2Strat", "pass2Sample", "outTable"} {
+			_, _ = fmt.Fprintf(summary, "  creates %s (%s)\n", specs.getVal(table, true), table)
+		}
+
+		for _, tbl := range econ {
+			_, _ = fmt.Fprintf(summary, "  creates %s (econ data, dropped after pass 3)\n", tbl.name)
+		}
+	}
+
+	queries := []struct {
+		on    bool
+		stage string
+		name  string
+	}{
+		{specs.buildModel(), "buildModel", "model"},
+		{specs.buildModel(), "buildModel", "validate"},
+		{specs.biasCorrect(), "biasCorrect", "bias"},
+		{specs.assessModel(), "assessModel", "assess"},
+		{specs.scoreModel(), "scoreModel", "score"},
+	}
+
+	lastStage := ""
+	for _, q := range queries {
+		if !q.on {
+			continue
+		}
+
+		if q.stage != lastStage {
+			_, _ = fmt.Fprintln(summary, q.stage)
+			lastStage = q.stage
+		}
+
+		qry := specs.getQuery(q.name)
+		if qry == "" {
+			continue
+		}
+
+		fileName := fmt.Sprintf("%s.sql", q.name)
+		if er := writePlan(planDir, fileName, qry); er != nil {
+			return er
+		}
+		_, _ = fmt.Fprintf(summary, "  %sQuery -> %s\n", q.name, fileName)
+	}
+
+	if specs.assessModel() {
+		if er := planMarginal(specs, planDir, summary, building); er != nil {
+			return er
+		}
+	}
+
+	if specs.assessModel() || specs.scoreModel() {
+		if table, fields, _, er := specs.saveTable(); er == nil && table != "" {
+			_, _ = fmt.Fprintf(summary, "  creates %s (saveTable) with model outputs %s\n", table, strings.Join(fields, ","))
+		}
+	}
+
+	if er := writePlan(planDir, "summary.txt", summary.String()); er != nil {
+		return er
+	}
+
+	fmt.Print(summary.String())
+	fmt.Printf("\nqueries written to %s\n", planDir)
+
+	return nil
+}
+
+// planMarginal writes the per-level marginal queries for each assess slicer.
+func planMarginal(specs specsMap, planDir string, summary *strings.Builder, building bool) error {
+	var fts sea.FTypes
+
+	if !building {
+		var e error
+		if fts, e = sea.LoadFTypes(specs.getVal("modelDir", true) + "fieldDefs.jsn"); e != nil {
+			return e
+		}
+	}
+
+	if _, e := makeSubDir(planDir, "marginal"); e != nil {
+		return e
+	}
+
+	for _, sl := range specs.slicer("assess") {
+		dir, e := makeSubDir(planDir+"marginal", sl.shortName)
+		if e != nil {
+			return e
+		}
+
+		var lvls []any
+		if ft := fts.Get(sl.feature); ft != nil && ft.FP != nil {
+			lvls, _ = ft.FP.Lvl.Sort(true, true)
+		}
+
+		if len(lvls) == 0 {
+			if e := writePlan(dir, sl.feature+".sql", marginalQuery(specs, sl.feature, "<level>")); e != nil {
+				return e
+			}
+			_, _ = fmt.Fprintf(summary, "  marginal %s: levels of %s unknown until the model is built\n", sl.shortName, sl.feature)
+			continue
+		}
+
+		for _, lvl := range lvls {
+			if e := writePlan(dir, fmt.Sprintf("%s%v.sql", sl.feature, lvl), marginalQuery(specs, sl.feature, lvl)); e != nil {
+				return e
+			}
+		}
+		_, _ = fmt.Fprintf(summary, "  marginal %s: %d levels of %s\n", sl.shortName, len(lvls), sl.feature)
+	}
+
+	return nil
+}
+
+// clearPlan removes the output of an earlier plan from planDir.  planDir is removed only if it holds nothing but
+// .sql files and summary.txt, so a mistyped -planDir can't remove anything else.
+func clearPlan(planDir string) error {
+	if _, e := os.Stat(planDir); os.IsNotExist(e) {
+		return nil
+	}
+
+	e := filepath.WalkDir(planDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".sql") || path == planDir+"summary.txt" {
+			return nil
+		}
+
+		return fmt.Errorf("%s is not a plan: it has %s, remove it or pick another -planDir", planDir, path)
+	})
+	if e != nil {
+		return &usageError{e}
+	}
+
+	return os.RemoveAll(planDir)
+}
+
+// writePlan writes text to dir/fileName
+func writePlan(dir, fileName, text string) error {
+	return os.WriteFile(slash(dir)+fileName, []byte(text+"\n"), 0644)
+}
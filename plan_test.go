@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClearPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string // files in planDir, nil for no planDir
+		wantErr string   // part of the error, "" if planDir is removed
+	}{
+		{name: "no dir"},
+		{name: "empty", files: []string{}},
+		{name: "plan", files: []string{"summary.txt", "pass1.sql", "marginal/fico/fico700.sql"}},
+		{name: "other file", files: []string{"summary.txt", "notes.txt"}, wantErr: "notes.txt"},
+		{name: "nested summary", files: []string{"marginal/summary.txt"}, wantErr: "summary.txt"},
+		{name: "model", files: []string{"pass1.sql", "model/fieldDefs.jsn"}, wantErr: "fieldDefs.jsn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planDir := slash(filepath.Join(t.TempDir(), "plan"))
+			if tt.files != nil {
+				if e := os.MkdirAll(planDir, 0755); e != nil {
+					t.Fatal(e)
+				}
+			}
+
+			for _, file := range tt.files {
+				if e := os.MkdirAll(filepath.Dir(planDir+file), 0755); e != nil {
+					t.Fatal(e)
+				}
+
+				if e := os.WriteFile(planDir+file, []byte("x"), 0644); e != nil {
+					t.Fatal(e)
+				}
+			}
+
+			e := clearPlan(planDir)
+			if tt.wantErr != "" {
+				var ue *usageError
+				if e == nil || !strings.Contains(e.Error(), tt.wantErr) || !errors.As(e, &ue) {
+					t.Fatalf("clearPlan() error = %v, want a usage error with %q", e, tt.wantErr)
+				}
+
+				for _, file := range tt.files {
+					if _, e := os.Stat(planDir + file); e != nil {
+						t.Errorf("%s removed", file)
+					}
+				}
+
+				return
+			}
+
+			if e != nil {
+				t.Fatalf("clearPlan() error = %v", e)
+			}
+
+			if _, e := os.Stat(planDir); !os.IsNotExist(e) {
+				t.Errorf("%s not removed", planDir)
+			}
+		})
+	}
+}
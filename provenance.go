@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// provenanceFile is the name of the provenance file in the model directory
+const provenanceFile = "provenance.json"
+
+// provenance records how a model was produced.  It is saved in the model directory, so it travels with the model
+// when the model is used as an input model or is bias-corrected.
+type provenance struct {
+	SpecsFile      string             `json:"specsFile"`      // .gom file that built the model
+	SpecsHash      string             `json:"specsHash"`      // sha256 of the .gom file
+	Created        time.Time          `json:"created"`        // time the run started
+	Versions       map[string]string  `json:"versions"`       // versions of goMortgage, Go and the key packages
+	Host           string             `json:"host"`           // ClickHouse host
+	Tables         map[string]string  `json:"tables"`         // ClickHouse tables, keyed by the .gom key
+	Queries        map[string]string  `json:"queries"`        // queries that pulled the pipelines, keyed by pipeline
+	Rows           map[string]int     `json:"rows"`           // rows in each pipeline (model, validate, bias, assess, score)
+	BestEpoch      int                `json:"bestEpoch"`      // best epoch of the fit
+	Costs          *fitCosts          `json:"costs"`          // costs of the fit
+	BiasAdjustment jsonFloats         `json:"biasAdjustment"` // adjustment to output-layer bias, if bias corrected
+	Timings        map[string]float64 `json:"timings"`        // run time of each stage, in minutes
+	InputModels    []*modelRef        `json:"inputModels"`    // input models to this model
+}
+
+// fitCosts are the values of the cost function at the best and final epochs.
+type fitCosts struct {
+	ModelBest       float64 `json:"modelBest"`
+	ModelFinal      float64 `json:"modelFinal"`
+	ValidationBest  float64 `json:"validationBest"`
+	ValidationFinal float64 `json:"validationFinal"`
+}
+
+// fitCostsJSON is fitCosts as saved.  A fit that diverges has NaN or infinite costs, which JSON can't hold.
+type fitCostsJSON struct {
+	ModelBest       json.RawMessage `json:"modelBest"`
+	ModelFinal      json.RawMessage `json:"modelFinal"`
+	ValidationBest  json.RawMessage `json:"validationBest"`
+	ValidationFinal json.RawMessage `json:"validationFinal"`
+}
+
+func (fc fitCosts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&fitCostsJSON{ModelBest: jsonFloat(fc.ModelBest), ModelFinal: jsonFloat(fc.ModelFinal),
+		ValidationBest: jsonFloat(fc.ValidationBest), ValidationFinal: jsonFloat(fc.ValidationFinal)})
+}
+
+func (fc *fitCosts) UnmarshalJSON(buf []byte) error {
+	saved := &fitCostsJSON{}
+	if e := json.Unmarshal(buf, saved); e != nil {
+		return e
+	}
+
+	for _, f := range []struct {
+		x   *float64
+		raw json.RawMessage
+	}{
+		{&fc.ModelBest, saved.ModelBest}, {&fc.ModelFinal, saved.ModelFinal},
+		{&fc.ValidationBest, saved.ValidationBest}, {&fc.ValidationFinal, saved.ValidationFinal},
+	} {
+		var e error
+		if *f.x, e = parseJSONFloat(f.raw); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// jsonFloats is a slice of floats that may hold NaN or infinite values.
+type jsonFloats []float64
+
+func (f jsonFloats) MarshalJSON() ([]byte, error) {
+	if f == nil {
+		return []byte("null"), nil
+	}
+
+	vals := make([]json.RawMessage, len(f))
+	for ind, x := range f {
+		vals[ind] = jsonFloat(x)
+	}
+
+	return json.Marshal(vals)
+}
+
+func (f *jsonFloats) UnmarshalJSON(buf []byte) error {
+	var vals []json.RawMessage
+	if e := json.Unmarshal(buf, &vals); e != nil {
+		return e
+	}
+
+	if vals == nil {
+		*f = nil
+		return nil
+	}
+
+	*f = make(jsonFloats, len(vals))
+	for ind, raw := range vals {
+		var e error
+		if (*f)[ind], e = parseJSONFloat(raw); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// jsonFloat encodes x.  JSON has no NaN or infinity, so these are saved as the strings "NaN", "+Inf" and "-Inf".
+func jsonFloat(x float64) json.RawMessage {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return json.RawMessage(strconv.Quote(strconv.FormatFloat(x, 'g', -1, 64)))
+	}
+
+	return json.RawMessage(strconv.FormatFloat(x, 'g', -1, 64))
+}
+
+// parseJSONFloat decodes a float encoded by jsonFloat.  A missing or null value is 0.
+func parseJSONFloat(raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		return strconv.ParseFloat(str, 64)
+	}
+
+	var x float64
+	e := json.Unmarshal(raw, &x)
+
+	return x, e
+}
+
+// modelRef identifies an input model by the hash of its provenance file.  Input models are nested when an input
+// model has input models of its own.
+type modelRef struct {
+	Name           string      `json:"name"`
+	ProvenanceHash string      `json:"provenanceHash"` // sha256 of the input model's provenance.json ("" if none)
+	InputModels    []*modelRef `json:"inputModels"`
+}
+
+// provTables are the .gom keys that name ClickHouse tables
+var provTables = []string{"mtgDb", "econDb", "pass1Strat", "pass1Sample", "pass2Strat", "pass2Sample",
+	"outTable", "saveTable"}
+
+// versions returns the versions of goMortgage, Go and the invertedv packages in the build.
+func versions() map[string]string {
+	vers := map[string]string{"go": "unknown", "goMortgage": "unknown"}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return vers
+	}
+
+	vers["go"] = info.GoVersion
+	vers["goMortgage"] = info.Main.Version
+
+	for _, dep := range info.Deps {
+		if strings.HasPrefix(dep.Path, "github.com/invertedv/") {
+			vers[strings.TrimPrefix(dep.Path, "github.com/invertedv/")] = dep.Version
+		}
+	}
+
+	return vers
+}
+
+// inputModelRefs returns the input models in modelDir/inputModels, recursing into their input models.
+func inputModelRefs(modelDir string) ([]*modelRef, error) {
+	inDir := slash(modelDir) + "inputModels/"
+	entries, e := os.ReadDir(inDir)
+	if e != nil {
+		if os.IsNotExist(e) {
+			return nil, nil
+		}
+		return nil, e
+	}
+
+	refs := make([]*modelRef, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		ref := &modelRef{Name: entry.Name()}
+		if hash, e := fileHash(inDir + entry.Name() + "/" + provenanceFile); e == nil {
+			ref.ProvenanceHash = hash
+		}
+
+		if ref.InputModels, e = inputModelRefs(inDir + entry.Name()); e != nil {
+			return nil, e
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// initProvenance starts the provenance for a run that builds the data or model.  For other runs, the provenance
+// of the existing model is updated, if there is one.  includes are the files specsFile includes.
+func initProvenance(specs specsMap, specsFile, host string, includes ...string) error {
+	modelDir := specs.getVal("modelDir", true)
+
+	if !specs.buildData() && !specs.buildModel() {
+		if _, e := os.Stat(modelDir + provenanceFile); e != nil {
+			return nil
+		}
+
+		return updateProvenance(specs, func(p *provenance) { p.Host = host })
+	}
+
+	// if we're resuming, keep what we have
+	if specs.resume() {
+		if _, e := os.Stat(modelDir + provenanceFile); e == nil {
+			return nil
+		}
+	}
+
+	hash, e := fileHash(append([]string{specsFile}, includes...)...)
+	if e != nil {
+		return e
+	}
+
+	prov := &provenance{
+		SpecsFile: specsFile,
+		SpecsHash: hash,
+		Created:   time.Now(),
+		Versions:  versions(),
+		Host:      host,
+		Tables:    make(map[string]string),
+		Queries:   make(map[string]string),
+		Rows:      make(map[string]int),
+		Timings:   make(map[string]float64),
+	}
+
+	for _, key := range provTables {
+		if table, ok := specs[key]; ok {
+			prov.Tables[key] = strings.TrimSpace(table)
+		}
+	}
+
+	if prov.InputModels, e = inputModelRefs(modelDir); e != nil {
+		return e
+	}
+
+	return prov.save(modelDir)
+}
+
+// loadProvenance loads the provenance from modelDir.
+func loadProvenance(modelDir string) (*provenance, error) {
+	buf, e := os.ReadFile(slash(modelDir) + provenanceFile)
+	if e != nil {
+		return nil, e
+	}
+
+	prov := &provenance{}
+	if e := json.Unmarshal(buf, prov); e != nil {
+		return nil, fmt.Errorf("cannot parse %s%s: %v", slash(modelDir), provenanceFile, e)
+	}
+
+	// these may be missing in the file
+	if prov.Tables == nil {
+		prov.Tables = make(map[string]string)
+	}
+
+	if prov.Queries == nil {
+		prov.Queries = make(map[string]string)
+	}
+
+	if prov.Rows == nil {
+		prov.Rows = make(map[string]int)
+	}
+
+	if prov.Timings == nil {
+		prov.Timings = make(map[string]float64)
+	}
+
+	return prov, nil
+}
+
+// save saves the provenance to modelDir.
+func (p *provenance) save(modelDir string) error {
+	buf, e := json.MarshalIndent(p, "", "  ")
+	if e != nil {
+		return e
+	}
+
+	return os.WriteFile(slash(modelDir)+provenanceFile, buf, 0644)
+}
+
+// updateProvenance applies update to the provenance in the current model directory.  If the model has no
+// provenance (e.g. it was built before provenance was recorded), nothing is done.
+func updateProvenance(specs specsMap, update func(p *provenance)) error {
+	modelDir := specs.getVal("modelDir", true)
+
+	prov, e := loadProvenance(modelDir)
+	if e != nil {
+		if os.IsNotExist(e) {
+			return nil
+		}
+		return e
+	}
+
+	update(prov)
+
+	return prov.save(modelDir)
+}
+
+// provenanceRows records the query and row count of the pipeline name.
+func provenanceRows(specs specsMap, name, qry string, rows int) error {
+	return updateProvenance(specs, func(p *provenance) {
+		p.Queries[name] = qry
+		p.Rows[name] = rows
+	})
+}
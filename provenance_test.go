@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProvenanceNonFinite(t *testing.T) {
+	tests := []struct {
+		name  string
+		costs *fitCosts
+		bias  jsonFloats
+		want  []string // parts of the saved file
+	}{
+		{name: "finite", costs: &fitCosts{ModelBest: 0.25, ModelFinal: 0.5, ValidationBest: 1e-7, ValidationFinal: 3},
+			bias: jsonFloats{0.1, -2}, want: []string{`"modelBest": 0.25`, `"validationBest": 1e-07`}},
+		{name: "diverged", costs: &fitCosts{ModelBest: 0.25, ModelFinal: math.NaN(), ValidationBest: math.Inf(1),
+			ValidationFinal: math.Inf(-1)}, bias: jsonFloats{math.NaN(), 1},
+			want: []string{`"modelFinal": "NaN"`, `"validationBest": "+Inf"`, `"validationFinal": "-Inf"`}},
+		{name: "no fit", want: []string{`"costs": null`, `"biasAdjustment": null`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir() + "/"
+			prov := &provenance{Costs: tt.costs, BiasAdjustment: tt.bias}
+			if e := prov.save(dir); e != nil {
+				t.Fatalf("save() error = %v", e)
+			}
+
+			buf, e := os.ReadFile(dir + provenanceFile)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(string(buf), want) {
+					t.Errorf("saved provenance doesn't have %s:\n%s", want, buf)
+				}
+			}
+
+			got, e := loadProvenance(dir)
+			if e != nil {
+				t.Fatalf("loadProvenance() error = %v", e)
+			}
+
+			if (got.Costs == nil) != (tt.costs == nil) {
+				t.Fatalf("costs = %v, want %v", got.Costs, tt.costs)
+			}
+
+			if tt.costs != nil {
+				for _, c := range [][2]float64{{got.Costs.ModelBest, tt.costs.ModelBest},
+					{got.Costs.ModelFinal, tt.costs.ModelFinal}, {got.Costs.ValidationBest, tt.costs.ValidationBest},
+					{got.Costs.ValidationFinal, tt.costs.ValidationFinal}} {
+					if !sameFloat(c[0], c[1]) {
+						t.Errorf("costs = %+v, want %+v", got.Costs, tt.costs)
+					}
+				}
+			}
+
+			if len(got.BiasAdjustment) != len(tt.bias) || (got.BiasAdjustment == nil) != (tt.bias == nil) {
+				t.Fatalf("biasAdjustment = %v, want %v", got.BiasAdjustment, tt.bias)
+			}
+
+			for ind, x := range tt.bias {
+				if !sameFloat(got.BiasAdjustment[ind], x) {
+					t.Errorf("biasAdjustment = %v, want %v", got.BiasAdjustment, tt.bias)
+				}
+			}
+		})
+	}
+}
+
+// sameFloat returns true if x and y are equal or both NaN.
+func sameFloat(x, y float64) bool {
+	return x == y || (math.IsNaN(x) && math.IsNaN(y))
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// latestRun is the name of the link in the root directory that points to the most recent run.
+const latestRun = "latest"
+
+// runPattern matches the names of run directories: <run number>-<yyyymmdd>-<hhmmss>
+var runPattern = regexp.MustCompile(`^(\d{4})-\d{8}-\d{6}$`)
+
+// runVersions returns true if the runVersions: key is yes.  In this case, each run is placed in its own
+// subdirectory of outDir.
+func (sf specsMap) runVersions() bool {
+	if val, ok := sf["runVersions"]; ok {
+		return val == yes
+	}
+
+	return false
+}
+
+// keepRuns returns the number of runs to keep, 0 means keep all of them.
+func (sf specsMap) keepRuns() (int, error) {
+	keepStr, ok := sf["keepRuns"]
+	if !ok {
+		return 0, nil
+	}
+
+	keep, e := strconv.ParseInt(strings.ReplaceAll(keepStr, " ", ""), base10, bits32)
+	if e != nil || keep <= 0 {
+		return 0, fmt.Errorf("keepRuns must be a positive integer, got %s", keepStr)
+	}
+
+	return int(keep), nil
+}
+
+// listRuns returns the run directories in rootDir, oldest first.
+func listRuns(rootDir string) ([]string, error) {
+	entries, e := os.ReadDir(rootDir)
+	if e != nil {
+		if os.IsNotExist(e) {
+			return nil, nil
+		}
+		return nil, e
+	}
+
+	runs := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() && runPattern.MatchString(entry.Name()) {
+			runs = append(runs, entry.Name())
+		}
+	}
+
+	sort.Strings(runs)
+
+	return runs, nil
+}
+
+// findRun returns the run directory in rootDir identified by runID.  runID may be the full directory name,
+// the run number or "latest".
+func findRun(rootDir, runID string) (string, error) {
+	if runID == "" || runID == latestRun {
+		target, e := os.Readlink(rootDir + latestRun)
+		if e != nil {
+			return "", fmt.Errorf("no runs in %s", rootDir)
+		}
+
+		return filepath.Base(target), nil
+	}
+
+	runs, e := listRuns(rootDir)
+	if e != nil {
+		return "", e
+	}
+
+	num, numErr := strconv.Atoi(runID)
+	for _, run := range runs {
+		if run == runID {
+			return run, nil
+		}
+
+		if n, _ := strconv.Atoi(runPattern.FindStringSubmatch(run)[1]); numErr == nil && n == num {
+			return run, nil
+		}
+	}
+
+	return "", fmt.Errorf("run %s not found in %s", runID, rootDir)
+}
+
+// newRun creates a new run directory in rootDir and points latest to it.
+func newRun(rootDir string) (string, error) {
+	if e := os.MkdirAll(rootDir, os.ModePerm); e != nil {
+		return "", e
+	}
+
+	runs, e := listRuns(rootDir)
+	if e != nil {
+		return "", e
+	}
+
+	num := 1
+	if len(runs) > 0 {
+		last, _ := strconv.Atoi(runPattern.FindStringSubmatch(runs[len(runs)-1])[1])
+		num = last + 1
+	}
+
+	run := fmt.Sprintf("%04d-%s", num, time.Now().Format("20060102-150405"))
+	if e := os.Mkdir(rootDir+run, os.ModePerm); e != nil {
+		return "", e
+	}
+
+	// repoint latest
+	if e := os.Remove(rootDir + latestRun); e != nil && !os.IsNotExist(e) {
+		return "", e
+	}
+
+	if e := os.Symlink(run, rootDir+latestRun); e != nil {
+		return "", e
+	}
+
+	return run, nil
+}
+
+// pruneRuns removes the runs beyond keepRuns, oldest first.  It's called once a run completes, and only if the run
+// created a new run directory, so a failed run never costs a good one.
+func (sf specsMap) pruneRuns() error {
+	if sf["newRun"] != yes {
+		return nil
+	}
+
+	keep, e := sf.keepRuns()
+	if e != nil || keep == 0 {
+		return e
+	}
+
+	rootDir := sf.getVal("runRoot", true)
+	runs, e := listRuns(rootDir)
+	if e != nil || len(runs) <= keep {
+		return e
+	}
+
+	for _, old := range runs[:len(runs)-keep] {
+		if e := os.RemoveAll(rootDir + old); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// setRunDir points outDir to the run directory if runVersions is yes.  The root directory (the outDir: key) is
+// saved in runRoot and the run directory name in runID.
+//
+// A new run is created if we're building the data or model (and not resuming).  Otherwise, the run is
+// given by runID (default: latest).
+func (sf specsMap) setRunDir(runID string, create bool) error {
+	if !sf.runVersions() {
+		if runID != "" {
+			return &usageError{fmt.Errorf("-run requires runVersions: yes")}
+		}
+
+		return nil
+	}
+
+	rootDir := slash(sf.getVal("outDir", true))
+	sf.assign("runRoot", rootDir)
+
+	// keepRuns is applied when the run completes, so check it now
+	if _, e := sf.keepRuns(); e != nil {
+		return &usageError{e}
+	}
+
+	var (
+		run string
+		e   error
+	)
+	switch create && !sf.resume() && (sf.buildData() || sf.buildModel()) {
+	case true:
+		if runID != "" {
+			return &usageError{fmt.Errorf("-run cannot be used when building the data or model")}
+		}
+
+		if run, e = newRun(rootDir); e != nil {
+			return e
+		}
+		sf.assign("newRun", yes)
+	case false:
+		if run, e = findRun(rootDir, runID); e != nil {
+			return &usageError{e}
+		}
+	}
+
+	sf.assign("runID", run)
+	sf.assign("outDir", slash(rootDir+run))
+
+	return nil
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gomFile is a .gom file.  The key values are in the embedded specsMap.  The types of the keys are given by keyTypes.
+type gomFile struct {
+	specsMap
+	asRead   specsMap          // keys as read, before any are set or assigned
+	name     string            // .gom file name
+	includes []string          // files included by the .gom file, directly or not, in the order read
+	lines    map[string]int    // line of the .gom file each key is on
+	files    map[string]string // file each key is from, if it's not name
+	names    map[string]string // key as written in the file, for keys numbered as duplicates
+	order    map[string]int    // order in which the keys were set
+	expanded bool              // true if ${name} references were replaced
+	refs     map[string]bool   // names of the -set values used by ${name} references
+	setKeys  []string          // keys set on the command line with -set, in the order set
+	varied   []string          // keys varied by a sweep, in the order set
+}
+
+// newGomFile returns an empty gomFile for the file name.
+func newGomFile(name string) *gomFile {
+	return &gomFile{specsMap: make(specsMap), asRead: make(specsMap), name: name, lines: make(map[string]int),
+		files: make(map[string]string), names: make(map[string]string), order: make(map[string]int),
+		refs: make(map[string]bool)}
+}
+
+// add sets key to val, as read from line of file.  name is the key as written in the file.
+func (gf *gomFile) add(key, name, val, file string, line int) {
+	gf.specsMap[key], gf.asRead[key] = val, val
+	gf.lines[key] = line
+	gf.order[key] = len(gf.order)
+
+	delete(gf.files, key)
+	if file != gf.name {
+		gf.files[key] = file
+	}
+
+	delete(gf.names, key)
+	if name != key {
+		gf.names[key] = name
+	}
+}
+
+// drop removes the keys read as name: the key itself and its numbered duplicates.  The order of the keys is kept so
+// that the keys set later stay after those set before.
+func (gf *gomFile) drop(name string) {
+	for key := range gf.asRead {
+		if key != name && gf.names[key] != name {
+			continue
+		}
+
+		delete(gf.specsMap, key)
+		delete(gf.asRead, key)
+		delete(gf.lines, key)
+		delete(gf.files, key)
+		delete(gf.names, key)
+	}
+}
+
+// override sets key to val as given on the command line with -set.  The value replaces the one read, so it is in the
+// file as saved.
+func (gf *gomFile) override(key, val string) {
+	if _, ok := gf.specsMap[key]; !ok {
+		gf.order[key] = len(gf.order)
+	}
+
+	gf.specsMap[key], gf.asRead[key] = val, val
+	if searchSlice(key, gf.setKeys) < 0 {
+		gf.setKeys = append(gf.setKeys, key)
+	}
+}
+
+// vary sets key to the value val of a sweep variant.  Like override, the value replaces the one read, so it is in the
+// file as saved.
+func (gf *gomFile) vary(key, val string) {
+	if _, ok := gf.specsMap[key]; !ok {
+		gf.order[key] = len(gf.order)
+	}
+
+	gf.specsMap[key], gf.asRead[key] = val, val
+	if searchSlice(key, gf.varied) < 0 {
+		gf.varied = append(gf.varied, key)
+	}
+}
+
+// fileOf returns the file key is from.
+func (gf *gomFile) fileOf(key string) string {
+	if file, ok := gf.files[key]; ok {
+		return file
+	}
+
+	return gf.name
+}
+
+// errorf returns an error for key that gives the file and line of the key.
+func (gf *gomFile) errorf(key, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+
+	if searchSlice(key, gf.setKeys) >= 0 {
+		return fmt.Errorf("-set %s: %s", key, msg)
+	}
+
+	if searchSlice(key, gf.varied) >= 0 {
+		return fmt.Errorf("sweep %s: %s", key, msg)
+	}
+
+	if line, ok := gf.lines[key]; ok {
+		return fmt.Errorf("%s:%d: %s: %s", gf.fileOf(key), line, key, msg)
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: %s", gf.name, msg)
+	}
+
+	return fmt.Errorf("%s: %s: %s", gf.name, key, msg)
+}
+
+// save writes the .gom file to fileName.  If the file includes other files, has ${name} references, has keys set
+// with -set or varied by a sweep or is YAML or JSON, the keys of all the files, merged and with the references replaced, are written in
+// .gom format so the copy describes the run on its own.
+func (gf *gomFile) save(fileName string) error {
+	if len(gf.includes) == 0 && !gf.expanded && len(gf.setKeys) == 0 && len(gf.varied) == 0 &&
+		!isStructured(gf.name) {
+		return copyFile(gf.name, fileName)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("// %s as a .gom file, with included files merged and ${name} references replaced\n", gf.name))
+	for _, inc := range gf.includes {
+		sb.WriteString(fmt.Sprintf("//    included %s\n", inc))
+	}
+
+	for _, key := range gf.setKeys {
+		sb.WriteString(fmt.Sprintf("//    -set %s\n", key))
+	}
+
+	for _, key := range gf.varied {
+		sb.WriteString(fmt.Sprintf("//    sweep %s\n", key))
+	}
+
+	from := ""
+	for _, key := range gf.keys() {
+		val, ok := gf.asRead[key]
+		if !ok {
+			continue
+		}
+
+		// keys that are only on the command line or in the sweep go last
+		_, inFile := gf.lines[key]
+		if !inFile && (searchSlice(key, gf.setKeys) >= 0 || searchSlice(key, gf.varied) >= 0) {
+			continue
+		}
+
+		if file := gf.fileOf(key); file != from {
+			sb.WriteString(fmt.Sprintf("\n// from %s\n", file))
+			from = file
+		}
+
+		name := key
+		if n, ok := gf.names[key]; ok {
+			name = n
+		}
+
+		switch {
+		case searchSlice(key, gf.setKeys) >= 0:
+			val += " // -set on the command line"
+		case searchSlice(key, gf.varied) >= 0:
+			val += " // varied by the sweep"
+		}
+
+		sb.WriteString(fmt.Sprintf("%s: %s\n", name, val))
+	}
+
+	header := "\n// from the command line\n"
+	for _, key := range gf.setKeys {
+		if _, inFile := gf.lines[key]; !inFile {
+			sb.WriteString(fmt.Sprintf("%s%s: %s\n", header, key, gf.asRead[key]))
+			header = ""
+		}
+	}
+
+	header = "\n// from the sweep\n"
+	for _, key := range gf.varied {
+		if _, inFile := gf.lines[key]; !inFile && searchSlice(key, gf.setKeys) < 0 {
+			sb.WriteString(fmt.Sprintf("%s%s: %s\n", header, key, gf.asRead[key]))
+			header = ""
+		}
+	}
+
+	return os.WriteFile(fileName, []byte(sb.String()), 0644)
+}
+
+// specErrors are the problems found in a .gom file.
+type specErrors []error
+
+func (se specErrors) Error() string {
+	msgs := make([]string, 0)
+	for _, e := range se {
+		msgs = append(msgs, e.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// keyKind is the type of value a key takes
+type keyKind int
+
+const (
+	kindInt     keyKind = iota // integer
+	kindFloat                  // floating point
+	kindYesNo                  // yes or no
+	kindTargets                // comma-separated list of model output columns and ranges of columns
+	kindEnum                   // one of a set of values
+)
+
+// keyType is the type of the value of a key
+type keyType struct {
+	kind   keyKind
+	min    float64  // numeric values must be at least min
+	above  bool     // numeric values must be more than min
+	max    float64  // numeric values must be at most max, if max > min
+	values []string // values an enum may take
+}
+
+// keyTypes are the keys that take values other than strings.  The key may end in a wildcard.
+var keyTypes = map[string]*keyType{
+	"runVersions":       {kind: kindYesNo},
+	"keepRuns":          {kind: kindInt, min: 1},
+	"buildData":         {kind: kindYesNo},
+	"buildModel":        {kind: kindYesNo},
+	"biasCorrect":       {kind: kindYesNo},
+	"assessModel":       {kind: kindYesNo},
+	"scoreModel":        {kind: kindYesNo},
+	"sampleSize1":       {kind: kindInt, min: 1},
+	"sampleSize2":       {kind: kindInt, min: 1},
+	"window":            {kind: kindInt, min: 1, max: 60},
+	"targetType":        {kind: kindEnum, values: []string{"cat", "cts"}},
+	"epochs":            {kind: kindInt, min: 1},
+	"batchSize":         {kind: kindInt, min: 1},
+	"learningRate":      {kind: kindFloat, min: 0, above: true, max: 1},
+	"learningRateStart": {kind: kindFloat, min: 0, above: true, max: 1},
+	"learningRateEnd":   {kind: kindFloat, min: 0, above: true, max: 1},
+	"earlyStopping":     {kind: kindInt, min: 1},
+	"l2Reg":             {kind: kindFloat, min: 0, above: true, max: 1},
+	"group*":            {kind: kindTargets},
+	"assessWorkers":     {kind: kindInt, min: 1},
+	"show":              {kind: kindYesNo},
+	"plotShow":          {kind: kindYesNo}, // the old name of show, read if show is not given
+	"plotHeight":        {kind: kindFloat, min: 1},
+	"plotWidth":         {kind: kindFloat, min: 1},
+}
+
+// typeOf returns the keyType of key, nil if key takes a string.
+func typeOf(key string) *keyType {
+	if kt, ok := keyTypes[key]; ok {
+		return kt
+	}
+
+	for name, kt := range keyTypes {
+		if strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*")) {
+			return kt
+		}
+	}
+
+	return nil
+}
+
+// checkValue checks that val is a valid value of the type kt.
+func (kt *keyType) checkValue(val string) error {
+	val = strings.TrimSpace(val)
+
+	switch kt.kind {
+	case kindYesNo:
+		if val != yes && val != no {
+			return fmt.Errorf("must be %s or %s, got %s", yes, no, val)
+		}
+	case kindEnum:
+		for _, v := range kt.values {
+			if val == v {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("must be one of %s, got %s", strings.Join(kt.values, ", "), val)
+	case kindInt:
+		i, e := strconv.ParseInt(strings.ReplaceAll(val, " ", ""), base10, bits32)
+		if e != nil {
+			return fmt.Errorf("must be an integer, got %s", val)
+		}
+
+		return kt.checkRange(float64(i), val)
+	case kindFloat:
+		f, e := strconv.ParseFloat(strings.ReplaceAll(val, " ", ""), bits64)
+		if e != nil {
+			return fmt.Errorf("must be a number, got %s", val)
+		}
+
+		return kt.checkRange(f, val)
+	case kindTargets:
+		if _, e := parseTargets(toSlice(val, ","), nil); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// checkRange checks that x is between kt.min and kt.max.  val is x as a string.
+func (kt *keyType) checkRange(x float64, val string) error {
+	if kt.above && x <= kt.min {
+		return fmt.Errorf("must be more than %v, got %s", kt.min, val)
+	}
+
+	if x < kt.min {
+		return fmt.Errorf("must be at least %v, got %s", kt.min, val)
+	}
+
+	if kt.max > kt.min && x > kt.max {
+		return fmt.Errorf("must be at most %v, got %s", kt.max, val)
+	}
+
+	return nil
+}
+
+// keys returns the keys in the order they were read.  Keys not from the file come last.
+func (gf *gomFile) keys() []string {
+	keys := make([]string, 0)
+	for key := range gf.specsMap {
+		keys = append(keys, key)
+	}
+
+	pos := func(key string) int {
+		if ord, ok := gf.order[key]; ok {
+			return ord
+		}
+
+		return math.MaxInt32
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return pos(keys[i]) < pos(keys[j]) || (pos(keys[i]) == pos(keys[j]) && keys[i] < keys[j])
+	})
+
+	return keys
+}
+
+// patterns for the size and activation of a layer, e.g. FC(size:3, activation:softmax)
+var (
+	sizePattern       = regexp.MustCompile(`size\s*:\s*(\d+)`)
+	activationPattern = regexp.MustCompile(`activation\s*:\s*(\w+)`)
+)
+
+// lastLayer returns the key of the last layer of the model, its size and its activation.  size is 0 if there are
+// no layers or the last layer doesn't give one.
+func (gf *gomFile) lastLayer() (key string, size int, activation string) {
+	for num := 1; ; num++ {
+		k := fmt.Sprintf("layer%d", num)
+		if _, ok := gf.specsMap[k]; !ok {
+			break
+		}
+		key = k
+	}
+
+	if key == "" {
+		return "", 0, ""
+	}
+
+	if m := sizePattern.FindStringSubmatch(gf.specsMap[key]); m != nil {
+		size, _ = strconv.Atoi(m[1])
+	}
+
+	if m := activationPattern.FindStringSubmatch(gf.specsMap[key]); m != nil {
+		activation = m[1]
+	}
+
+	return key, size, activation
+}
+
+// renamedKeys are keys that have been renamed, and their new names.
+var renamedKeys = map[string]string{
+	"PlotWidth":  "plotWidth",
+	"PlotHeight": "plotHeight",
+	"addlCats":   "addlCat",
+}
+
+// internalKeys are keys goMortgage sets as it runs.  They can't be set in the .gom file.
+var internalKeys = []string{"modelDir", "graphDir", "valDir", "margDir", "costDir", "stratsDir", "curvesDir",
+	"inputDir", "runRoot", "runID", "newRun", "resume", "calc", "where", "with", "fields", "goodLoan", "arrayJoin"}
+
+// unknown returns the error for the unknown key.  readSpecsMap adds a number to repeated keys, so the key may be a
+// duplicate of a known key.
+func (gf *gomFile) unknown(key string) error {
+	if newKey, ok := renamedKeys[key]; ok {
+		return gf.errorf(key, "unknown key, renamed %s", newKey)
+	}
+
+	if searchSlice(key, internalKeys) >= 0 {
+		return gf.errorf(key, "set by goMortgage, cannot be in the .gom file")
+	}
+
+	base := strings.TrimRight(key, "0123456789")
+	first, ok := gf.lines[base]
+	if base == key || !ok {
+		return gf.errorf(key, "unknown key")
+	}
+	if gf.fileOf(base) != gf.fileOf(key) {
+		return fmt.Errorf("%s:%d: %s: duplicate key, first set in %s:%d", gf.fileOf(key), gf.lines[key], base,
+			gf.fileOf(base), first)
+	}
+
+	return fmt.Errorf("%s:%d: %s: duplicate key, first set on line %d", gf.fileOf(key), gf.lines[key], base, first)
+}
+
+// check checks the .gom file.  Every key must be known and have a value of the right type.  The keys the stages
+// need must be present and keys that depend on other keys must have them. All the problems found are reported.
+func (gf *gomFile) check() error {
+	errs := make(specErrors, 0)
+
+	gf.resolveSource()
+	gf.resolvePath("econSql", isDir)
+
+	// a parquet tape is read by the ClickHouse server, so its path is on the server
+	if !gf.specsMap.tapeParquet() {
+		gf.resolvePath("tapeFile", isFile)
+	}
+
+	known := strings.Split(strings.ReplaceAll(allKeys, "\n", ""), ",")
+
+	for _, key := range gf.keys() {
+		if !checkKey(key, known) {
+			errs = append(errs, gf.unknown(key))
+			continue
+		}
+
+		if kt := typeOf(key); kt != nil {
+			if e := kt.checkValue(gf.specsMap[key]); e != nil {
+				errs = append(errs, gf.errorf(key, "%v", e))
+			}
+		}
+	}
+
+	errs = append(errs, gf.checkDependencies()...)
+
+	// unknown keys or bad values would be reported again by specsMap.check
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if e := gf.specsMap.check(); e != nil {
+		return gf.errorf("", "%v", e)
+	}
+
+	return nil
+}
+
+// checkDependencies checks keys that require or exclude other keys.
+func (gf *gomFile) checkDependencies() specErrors {
+	errs := make(specErrors, 0)
+	sf := gf.specsMap
+
+	has := func(key string) bool {
+		_, ok := sf[key]
+		return ok
+	}
+
+	groups, groupErr := sf.targetGroups()
+
+	// assessments and curves need a name, target and slicer
+	for _, base := range []string{"assess", "curves"} {
+		for _, key := range gf.keys() {
+			for _, part := range []string{"Name", "Target", "Slicer"} {
+				if !strings.HasPrefix(key, base+part) {
+					continue
+				}
+
+				shortName := strings.TrimPrefix(key, base+part)
+				for _, need := range []string{"Name", "Target", "Slicer"} {
+					if !has(base + need + shortName) {
+						errs = append(errs, gf.errorf(key, "requires %s%s%s", base, need, shortName))
+					}
+				}
+
+				if part != "Target" {
+					continue
+				}
+
+				// the targets may use groups, so they are checked here rather than by type.  Bad groups are reported
+				// by the group keys.
+				if groupErr != nil {
+					continue
+				}
+
+				trgs, e := parseTargets(toSlice(sf[key], ","), groups)
+				if e != nil {
+					errs = append(errs, gf.errorf(key, "%v", e))
+					continue
+				}
+
+				// a continuous target has a single output column, 0
+				if sf["targetType"] == "cts" && (len(trgs) != 1 || trgs[0] != 0) {
+					errs = append(errs, gf.errorf(key, "the target is continuous, so the target must be 0"))
+				}
+			}
+		}
+	}
+
+	// learning rate: learningRate or learningRateStart and learningRateEnd
+	switch {
+	case has("learningRate") && (has("learningRateStart") || has("learningRateEnd")):
+		errs = append(errs, gf.errorf("learningRate", "cannot be used with learningRateStart/learningRateEnd"))
+	case has("learningRateStart") != has("learningRateEnd"):
+		key := "learningRateStart"
+		if has("learningRateEnd") {
+			key = "learningRateEnd"
+		}
+		errs = append(errs, gf.errorf(key, "requires both learningRateStart and learningRateEnd"))
+	case sf.buildModel() && !has("learningRate") && !has("learningRateStart"):
+		errs = append(errs, gf.errorf("buildModel", "requires learningRate or learningRateStart and learningRateEnd"))
+	}
+
+	if sf.buildModel() && has("validateQuery") && !has("earlyStopping") {
+		errs = append(errs, gf.errorf("validateQuery", "requires earlyStopping"))
+	}
+
+	// layers are numbered 1, 2, ... with no gaps
+	for _, key := range gf.keys() {
+		if !strings.HasPrefix(key, "layer") {
+			continue
+		}
+
+		num, e := strconv.Atoi(strings.TrimPrefix(key, "layer"))
+		if e != nil || num < 1 {
+			errs = append(errs, gf.errorf(key, "layers must be layer1, layer2, ..."))
+			continue
+		}
+
+		if num > 1 && !has(fmt.Sprintf("layer%d", num-1)) {
+			errs = append(errs, gf.errorf(key, "requires layer%d", num-1))
+		}
+	}
+
+	if has("econSql") && !isDir(sf["econSql"]) {
+		errs = append(errs, gf.errorf("econSql", "%s is not a directory", sf["econSql"]))
+	}
+
+	if has("mtgFields") && sf.buildData() {
+		_, srcErr := sf.source()
+		if srcErr != nil {
+			errs = append(errs, gf.errorf("mtgFields", "%v", srcErr))
+		}
+
+		levels, _, econErr := sf.econSpec()
+		if econErr != nil && has("econFields") {
+			errs = append(errs, gf.errorf("econFields", "%v", econErr))
+		}
+
+		if econErr == nil && has("econFallback") {
+			if _, econErr = sf.econFallback(levels); econErr != nil {
+				errs = append(errs, gf.errorf("econFallback", "%v", econErr))
+			}
+		}
+
+		// the source must have the geo field of each level
+		if srcErr == nil && econErr == nil {
+			if key, e := sf.checkEconLevels(); e != nil {
+				errs = append(errs, gf.errorf(key, "%v", e))
+				econErr = e
+			}
+		}
+
+		if _, e := sf.econDates(); e != nil {
+			errs = append(errs, gf.errorf("econAnchors", "%v", e))
+			econErr = e
+		}
+
+		if flds, e := sf.econFieldList(); e == nil && has("econLags") {
+			if _, e := sf.econLags(flds); e != nil {
+				errs = append(errs, gf.errorf("econLags", "%v", e))
+				econErr = e
+			}
+		}
+
+		// the econ fields the source uses must be in the econ field list
+		if srcErr == nil && econErr == nil {
+			if e := sf.checkPass3Fields(); e != nil {
+				errs = append(errs, gf.errorf("mtgFields", "%v", e))
+			}
+		}
+	}
+
+	if has("tapeFile") && sf.buildData() {
+		if key, e := sf.checkTape(); e != nil {
+			errs = append(errs, gf.errorf(key, "%v", e))
+		}
+	}
+
+	if has("tapeMap") && !has("tapeFile") {
+		errs = append(errs, gf.errorf("tapeMap", "requires tapeFile"))
+	}
+
+	if has("keepRuns") && !sf.runVersions() {
+		errs = append(errs, gf.errorf("keepRuns", "requires runVersions: yes"))
+	}
+
+	if has("saveTableTargets") {
+		if !has("saveTable") {
+			errs = append(errs, gf.errorf("saveTableTargets", "requires saveTable"))
+		}
+
+		if _, _, _, e := sf.saveTable(); e != nil && groupErr == nil {
+			errs = append(errs, gf.errorf("saveTableTargets", "%v", e))
+		}
+	}
+
+	if _, e := sf.embFeatures(true); e != nil {
+		errs = append(errs, gf.errorf("emb", "%v", e))
+	}
+
+	// the targets of assessments, curves and saveTableTargets are output columns of the last layer
+	if key, size, _ := gf.lastLayer(); size > 0 {
+		if sf["targetType"] == "cts" && size != 1 {
+			errs = append(errs, gf.errorf(key, "the target is continuous, so the last layer must have size 1"))
+		}
+
+		// groups are checked on their own, so the items that name groups are skipped and each bad target is
+		// reported once
+		check := func(k string, items []string) {
+			for _, item := range items {
+				trgs, _ := parseTargets([]string{item}, nil)
+				for _, trg := range trgs {
+					if trg >= size {
+						errs = append(errs, gf.errorf(k, "target %d is not an output of the model, %s has outputs 0 to %d",
+							trg, key, size-1))
+					}
+				}
+			}
+		}
+
+		for _, k := range gf.keys() {
+			if strings.HasPrefix(k, "assessTarget") || strings.HasPrefix(k, "curvesTarget") ||
+				strings.HasPrefix(k, "group") {
+				check(k, toSlice(sf[k], ","))
+			}
+		}
+
+		if _, items, e := splitFieldTargets(sf["saveTableTargets"]); e == nil && has("saveTableTargets") {
+			for _, item := range items {
+				check("saveTableTargets", item)
+			}
+		}
+	}
+
+	// input models need a location and targets
+	for _, key := range gf.keys() {
+		name := sf[key]
+		if !strings.HasPrefix(key, "inputModel") {
+			continue
+		}
+
+		for _, need := range []string{"location", "targets"} {
+			if !has(need + name) {
+				errs = append(errs, gf.errorf(key, "requires %s%s", need, name))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string // keys that replace those of scripts/dq.gom
+		wantErr   string            // part of the error, "" if the specs are good
+	}{
+		{name: "good"},
+		{name: "good values", overrides: map[string]string{"l2Reg": "0.5", "learningRateStart": "1",
+			"earlyStopping": "1", "window": "60"}},
+		{name: "not an integer", overrides: map[string]string{"epochs": "5o"}, wantErr: "epochs: must be an integer, got 5o"},
+		{name: "not a number", overrides: map[string]string{"l2Reg": "small"}, wantErr: "l2Reg: must be a number"},
+		{name: "not yes or no", overrides: map[string]string{"show": "maybe"}, wantErr: "show: must be yes or no"},
+		{name: "not in enum", overrides: map[string]string{"targetType": "ord"}, wantErr: "targetType: must be one of cat, cts"},
+		{name: "zero l2Reg", overrides: map[string]string{"l2Reg": "0"}, wantErr: "l2Reg: must be more than 0"},
+		{name: "negative l2Reg", overrides: map[string]string{"l2Reg": "-0.1"}, wantErr: "l2Reg: must be more than 0"},
+		{name: "big l2Reg", overrides: map[string]string{"l2Reg": "2"}, wantErr: "l2Reg: must be at most 1"},
+		{name: "zero learning rate", overrides: map[string]string{"learningRateStart": "0"},
+			wantErr: "learningRateStart: must be more than 0"},
+		{name: "negative learning rate", overrides: map[string]string{"learningRateEnd": "-0.0001"},
+			wantErr: "learningRateEnd: must be more than 0"},
+		{name: "big learning rate", overrides: map[string]string{"learningRateStart": "1.5"},
+			wantErr: "learningRateStart: must be at most 1"},
+		{name: "zero earlyStopping", overrides: map[string]string{"earlyStopping": "0"},
+			wantErr: "earlyStopping: must be at least 1"},
+		{name: "big window", overrides: map[string]string{"window": "61"}, wantErr: "window: must be at most 60"},
+		{name: "bad group", overrides: map[string]string{"groupD": "3-x"}, wantErr: "groupD"},
+		{name: "learning rates conflict", overrides: map[string]string{"learningRate": "0.001"},
+			wantErr: "learningRate: cannot be used with learningRateStart/learningRateEnd"},
+		{name: "unknown key", overrides: map[string]string{"fooBar": "1"}, wantErr: "fooBar: unknown key"},
+		{name: "renamed key", overrides: map[string]string{"addlCats": "vintage"}, wantErr: "renamed addlCat"},
+		{name: "old show", overrides: map[string]string{"plotShow": "yes"}},
+		{name: "internal key", overrides: map[string]string{"modelDir": "/tmp/"}, wantErr: "set by goMortgage"},
+		{name: "layer gap", overrides: map[string]string{"layer9": "FC(size:2, activation:softmax)"},
+			wantErr: "layer9: requires layer8"},
+		{name: "several", overrides: map[string]string{"l2Reg": "0", "epochs": "0"},
+			wantErr: "epochs: must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides := map[string]string{"outDir": t.TempDir() + "/"}
+			for k, v := range tt.overrides {
+				overrides[k] = v
+			}
+
+			opts := &runOpts{specsFile: "scripts/dq.gom", vars: make(setVars), overrides: overrides}
+
+			_, e := opts.loadSpecs(nil)
+			if tt.wantErr == "" {
+				if e != nil {
+					t.Errorf("loadSpecs() error = %v", e)
+				}
+
+				return
+			}
+
+			if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+				t.Errorf("loadSpecs() error = %v, want %q", e, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		wantErr []string // parts of the errors, in order
+	}{
+		{name: "learning rate", keys: map[string]string{"buildModel": yes, "learningRate": "0.001"}},
+		{name: "learning rate range", keys: map[string]string{"buildModel": yes, "learningRateStart": "0.001",
+			"learningRateEnd": "0.0001"}},
+		{name: "no learning rate", keys: map[string]string{"buildModel": yes},
+			wantErr: []string{"buildModel: requires learningRate or learningRateStart and learningRateEnd"}},
+		{name: "no learning rate, no model", keys: map[string]string{"buildModel": no}},
+		{name: "learning rate and start", keys: map[string]string{"learningRate": "0.001", "learningRateStart": "0.001"},
+			wantErr: []string{"learningRate: cannot be used with learningRateStart/learningRateEnd"}},
+		{name: "start only", keys: map[string]string{"learningRateStart": "0.001"},
+			wantErr: []string{"learningRateStart: requires both learningRateStart and learningRateEnd"}},
+		{name: "end only", keys: map[string]string{"learningRateEnd": "0.001"},
+			wantErr: []string{"learningRateEnd: requires both learningRateStart and learningRateEnd"}},
+		{name: "validation without early stopping", keys: map[string]string{"buildModel": yes, "learningRate": "0.1",
+			"validateQuery": "SELECT %s FROM t"}, wantErr: []string{"validateQuery: requires earlyStopping"}},
+		{name: "assessment parts", keys: map[string]string{"assessName1": "dq"},
+			wantErr: []string{"assessName1: requires assessTarget1", "assessName1: requires assessSlicer1"}},
+		{name: "continuous target", keys: map[string]string{"targetType": "cts", "assessName1": "x",
+			"assessTarget1": "1", "assessSlicer1": "noGroups"},
+			wantErr: []string{"assessTarget1: the target is continuous, so the target must be 0"}},
+		{name: "target group", keys: map[string]string{"groupD": "1-3", "assessName1": "x",
+			"assessTarget1": "D, 4", "assessSlicer1": "noGroups"}},
+		{name: "unknown group", keys: map[string]string{"assessName1": "x", "assessTarget1": "D", "assessSlicer1": "noGroups"},
+			wantErr: []string{"assessTarget1"}},
+		{name: "layers", keys: map[string]string{"layer1": "FC", "layer3": "FC"},
+			wantErr: []string{"layer3: requires layer2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gf := newGomFile("test.gom")
+			line := 0
+			for _, key := range sortedKeys(tt.keys) {
+				line++
+				gf.add(key, key, tt.keys[key], gf.name, line)
+			}
+
+			errs := gf.checkDependencies()
+			if len(errs) != len(tt.wantErr) {
+				t.Fatalf("checkDependencies() = %v, want %d errors", errs, len(tt.wantErr))
+			}
+
+			for ind, e := range errs {
+				if !strings.Contains(e.Error(), tt.wantErr[ind]) {
+					t.Errorf("error %d = %v, want %q", ind, e, tt.wantErr[ind])
+				}
+			}
+		})
+	}
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0)
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/invertedv/chutils"
+	sea "github.com/invertedv/seafan"
+)
+
+// score runs the model on the data pulled by scoreQuery and saves the data plus the model outputs specified by
+// saveTableTargets to saveTable.
+//
+// The score query has the same format as the assess query.
+func score(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
+	var (
+		fts       sea.FTypes
+		scorePipe sea.Pipeline
+		e         error
+	)
+
+	start := time.Now()
+	log.start("scoring", start)
+
+	if fts, e = sea.LoadFTypes(specs.getVal("modelDir", true) + "fieldDefs.jsn"); e != nil {
+		return e
+	}
+
+	obsFt := fts.Get(specs.getVal("target", true))
+
+	if scorePipe, e = newPipe(specs.getQuery("score"), "Score data", specs, 0, fts, conn); e != nil {
+		return e
+	}
+
+	log.debug("pipeline", fmt.Sprintf("\n\n%v", scorePipe))
+
+	if e := provenanceRows(specs, "score", specs.getQuery("score"), scorePipe.Rows()); e != nil {
+		return e
+	}
+
+	// the saveTableTargets must be outputs of the model
+	nn, e := sea.LoadNN(specs.modelRoot(), scorePipe, false)
+	if e != nil {
+		return e
+	}
+
+	if e := specs.checkOutputs(nn.OutputCols()); e != nil {
+		return e
+	}
+
+	if e := interrupted(ctx); e != nil {
+		return e
+	}
+
+	if e := export(scorePipe, specs, obsFt, conn); e != nil {
+		return e
+	}
+
+	log.end("scoring", start)
+
+	return nil
+}
@@ -1,23 +1,26 @@
 #!/usr/bin/bash
 go build ../
 
-read -p "User: " user
-read -s -p "Password: " password
+# credentials are passed in the environment so they don't show up in ps.
+# Alternatively, put them in $HOME/.goMortgage/connections.json
+read -p "User: " GOMORTGAGE_USER
+read -s -p "Password: " GOMORTGAGE_PASSWORD
 echo ""
+export GOMORTGAGE_USER GOMORTGAGE_PASSWORD
 
-./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/dq.gom
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/prepayScore.gom
+./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/dq.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/prepayScore.gom
 
 
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/mod.gom
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/allInEven.gom
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/allInStrat.gom
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/allInEvenStrat.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/mod.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/allInEven.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/allInStrat.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/allInEvenStrat.gom
 
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/netPro.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/netPro.gom
 
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/allInEven1.gom
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/allInEvenStrat1.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/allInEven1.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/allInEvenStrat1.gom
 
-#./goMortgage -user $user -pw $password -specs /home/will/GolandProjects/goMortgage/scripts/test.gom
+#./goMortgage -specs /home/will/GolandProjects/goMortgage/scripts/test.gom
 
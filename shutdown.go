@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/invertedv/chutils"
+	sea "github.com/invertedv/seafan"
+	G "gorgonia.org/gorgonia"
+)
+
+// errInterrupted is returned by a stage that stopped before producing usable output because the run was
+// interrupted.
+var errInterrupted = errors.New("run interrupted")
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM.  Stages check the context between
+// queries and epochs, so the step under way is finished before the run stops.  A second signal kills the run.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigs:
+			// restore the default behavior, so a second signal stops the run immediately
+			signal.Stop(sigs)
+			_, _ = fmt.Fprintln(os.Stderr, "\ninterrupted: stopping after the current step (interrupt again to quit now)")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+// interrupted returns errInterrupted if ctx is done.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+
+	return nil
+}
+
+// dropTables drops tables from ClickHouse.  It is used to remove the tables of a step that did not finish.
+func dropTables(conn *chutils.Connect, tables ...string) error {
+	for _, table := range tables {
+		if _, e := conn.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// stopPipe is the modeling pipeline as seen by the fit.  Once ctx is done, it stops the fit at the start of the next
+// epoch, so the epoch under way is finished and the best model so far has been saved.  seafan has no hook to end a
+// fit, so stopPipe ends every remaining epoch with no batches.  onStop is called once, when the first epoch is skipped.
+type stopPipe struct {
+	sea.Pipeline
+	ctx     context.Context
+	onStop  func()
+	inEpoch bool // true if an epoch is under way
+	stopped bool // true if an epoch was skipped
+}
+
+// Batch loads the next batch into inputs.  It returns false, ending the epoch, if ctx is done and no epoch is under
+// way.
+func (sp *stopPipe) Batch(inputs G.Nodes) bool {
+	if !sp.inEpoch && sp.ctx.Err() != nil {
+		if !sp.stopped && sp.onStop != nil {
+			sp.onStop()
+		}
+		sp.stopped = true
+
+		return false
+	}
+
+	sp.inEpoch = sp.Pipeline.Batch(inputs)
+
+	return sp.inEpoch
+}
+
+// stopPass returns errInterrupted if ctx is done.  The tables of the unfinished pass are dropped.
+func stopPass(ctx context.Context, conn *chutils.Connect, log *runLog, tables ...string) error {
+	if interrupted(ctx) == nil {
+		return nil
+	}
+
+	if e := dropTables(conn, tables...); e != nil {
+		return e
+	}
+
+	log.warn("dropTables", fmt.Sprintf("dropped partial tables %s", strings.Join(tables, ", ")))
+
+	return errInterrupted
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// built-in data sources
+const (
+	fannie  = "fannie"
+	freddie = "freddie"
+	tape    = "tape"
+)
+
+// sourceFiles are the .sql files of the built-in data sources, a directory for each.
+//
+//go:embed sql/fannie sql/freddie sql/tape
+var sourceFiles embed.FS
+
+// dataSource is a source of loan-level data.  It supplies the SQL fragments the passes of buildData use to select
+// loans and calculate fields.
+type dataSource interface {
+	goodLoan() string               // pass 1 WHERE clause that restricts the loans to those that pass QA
+	pass1Fields() string            // pass 1 fields, at the as-of date
+	mtgFields(window bool) string   // pass 2 fields of the loan-level table to keep
+	pass2Fields(window bool) string // pass 2 fields, including the targets
+	pass3Fields() string            // pass 3 calculations, run when the econ data is joined
+}
+
+// dataSources are the built-in data sources, by the name used as the value of mtgFields.  Sources that aren't
+// built in are given to mtgFields as a directory of .sql files.
+var dataSources = map[string]func() (dataSource, error){
+	fannie:  embeddedSource(fannie),
+	freddie: embeddedSource(freddie),
+	tape:    embeddedSource(tape),
+}
+
+// embeddedSource returns a function that loads the built-in data source name.
+func embeddedSource(name string) func() (dataSource, error) {
+	return func() (dataSource, error) {
+		files, e := fs.Sub(sourceFiles, "sql/"+name)
+		if e != nil {
+			return nil, e
+		}
+
+		return loadSQLSource(files)
+	}
+}
+
+// sourceFragments are the fragments of a data source.  In a directory, each is a file: <fragment>.sql.
+var sourceFragments = []string{"goodLoan", "pass1Fields", "mtgFieldsStatic", "mtgFieldsMonthly", "pass2Fields",
+	"pass2FieldsWindow", "pass3Fields"}
+
+// sqlSource is a data source whose fragments are read from .sql files.
+type sqlSource struct {
+	frags map[string]string // fragments, keyed by the file name without .sql
+}
+
+// loadSQLSource loads the fragments of a data source from files.  Every fragment must be there.
+func loadSQLSource(files fs.FS) (dataSource, error) {
+	src := &sqlSource{frags: make(map[string]string)}
+	missing := make([]string, 0)
+
+	for _, frag := range sourceFragments {
+		buf, e := fs.ReadFile(files, frag+".sql")
+		if e != nil {
+			missing = append(missing, frag+".sql")
+			continue
+		}
+
+		src.frags[frag] = string(buf)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	return src, nil
+}
+
+func (src *sqlSource) goodLoan() string {
+	return src.frags["goodLoan"]
+}
+
+func (src *sqlSource) pass1Fields() string {
+	return src.frags["pass1Fields"]
+}
+
+// mtgFields returns the static fields and, if there is no window, the monthly fields.
+func (src *sqlSource) mtgFields(window bool) string {
+	if window {
+		return src.frags["mtgFieldsStatic"]
+	}
+
+	return fmt.Sprintf("%s, %s", src.frags["mtgFieldsStatic"], src.frags["mtgFieldsMonthly"])
+}
+
+func (src *sqlSource) pass2Fields(window bool) string {
+	if window {
+		return src.frags["pass2FieldsWindow"]
+	}
+
+	return src.frags["pass2Fields"]
+}
+
+func (src *sqlSource) pass3Fields() string {
+	return src.frags["pass3Fields"]
+}
+
+// loadedSources are the data sources loaded so far, by the value of mtgFields.  A source is loaded once, so every
+// pass of a run uses the fragments that check saw.
+var (
+	loadedSources = make(map[string]dataSource)
+	sourcesMu     sync.Mutex
+)
+
+// source returns the data source given by the mtgFields key: the name of a built-in source or a directory of .sql
+// files with the fragments of the source.
+func (sf specsMap) source() (dataSource, error) {
+	name := sf["mtgFields"]
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	if src, ok := loadedSources[name]; ok {
+		return src, nil
+	}
+
+	src, e := loadSource(name)
+	if e != nil {
+		return nil, e
+	}
+
+	loadedSources[name] = src
+
+	return src, nil
+}
+
+// loadSource loads the data source name: a built-in source or a directory of .sql files.
+func loadSource(name string) (dataSource, error) {
+	if load, ok := dataSources[name]; ok {
+		return load()
+	}
+
+	if !isDir(name) {
+		names := make([]string, 0)
+		for n := range dataSources {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("unknown source %s, must be one of %s or a directory of .sql files", name,
+			strings.Join(names, ", "))
+	}
+
+	src, e := loadSQLSource(os.DirFS(name))
+	if e != nil {
+		return nil, fmt.Errorf("source %s: %v", name, e)
+	}
+
+	return src, nil
+}
+
+// resolveSource makes a source directory given by mtgFields relative to the .gom file it's in.
+func (gf *gomFile) resolveSource() {
+	if _, builtIn := dataSources[gf.specsMap["mtgFields"]]; builtIn {
+		return
+	}
+
+	gf.resolvePath("mtgFields", isDir)
+}
+
+// resolvePath makes the path given by key relative to the .gom file it's in, if exists is true for that path.
+// Otherwise, check reports the value as given.  Paths given with -set are relative to the working directory.
+func (gf *gomFile) resolvePath(key string, exists func(path string) bool) {
+	val, ok := gf.specsMap[key]
+	if !ok || val == "" || filepath.IsAbs(val) || searchSlice(key, gf.setKeys) >= 0 {
+		return
+	}
+
+	if path := filepath.Join(filepath.Dir(gf.fileOf(key)), val); exists(path) {
+		gf.specsMap[key] = path
+	}
+}
+
+// isDir returns true if path is a directory.
+func isDir(path string) bool {
+	info, e := os.Stat(path)
+
+	return e == nil && info.IsDir()
+}
+
+// isFile returns true if path is a file.
+func isFile(path string) bool {
+	info, e := os.Stat(path)
+
+	return e == nil && !info.IsDir()
+}
+
+// The methods below return the fragments of the data source.
+
+// mtgFields returns the pass 2 fields of the loan-level table to keep.
+func (sf specsMap) mtgFields() (string, error) {
+	src, e := sf.source()
+	if e != nil {
+		return "", e
+	}
+
+	w, e := sf.window()
+	if e != nil {
+		return "", e
+	}
+
+	return src.mtgFields(w > 0), nil
+}
+
+// goodLoan returns the pass 1 WHERE clause that restricts the loans to those that pass QA.
+func (sf specsMap) goodLoan() (string, error) {
+	src, e := sf.source()
+	if e != nil {
+		return "", e
+	}
+
+	return src.goodLoan(), nil
+}
+
+// pass1Fields returns the pass 1 fields.
+func (sf specsMap) pass1Fields() (string, error) {
+	src, e := sf.source()
+	if e != nil {
+		return "", e
+	}
+
+	return src.pass1Fields(), nil
+}
+
+// pass2Fields returns the pass 2 fields.
+func (sf specsMap) pass2Fields() (string, error) {
+	src, e := sf.source()
+	if e != nil {
+		return "", e
+	}
+
+	w, e := sf.window()
+	if e != nil {
+		return "", e
+	}
+
+	return src.pass2Fields(w > 0), nil
+}
+
+// pass3Fields returns the pass 3 calculations.
+func (sf specsMap) pass3Fields() (string, error) {
+	src, e := sf.source()
+	if e != nil {
+		return "", e
+	}
+
+	return src.pass3Fields(), nil
+}
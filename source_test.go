@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	full := t.TempDir()
+	for _, frag := range sourceFragments {
+		if e := os.WriteFile(filepath.Join(full, frag+".sql"), []byte("lns."+frag), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	partial := t.TempDir()
+	if e := os.WriteFile(filepath.Join(partial, "goodLoan.sql"), []byte("1"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	tests := []struct {
+		name    string
+		specs   specsMap
+		mtg     string // want from mtgFields
+		pass2   string // want from pass2Fields
+		wantErr string // part of the error
+	}{
+		{name: "directory", specs: specsMap{"mtgFields": full},
+			mtg: "lns.mtgFieldsStatic, lns.mtgFieldsMonthly", pass2: "lns.pass2Fields"},
+		{name: "window", specs: specsMap{"mtgFields": full, "window": "6"},
+			mtg: "lns.mtgFieldsStatic", pass2: "lns.pass2FieldsWindow"},
+		{name: "missing fragments", specs: specsMap{"mtgFields": partial}, wantErr: "missing pass1Fields.sql"},
+		{name: "unknown", specs: specsMap{"mtgFields": "ginnie"}, wantErr: "unknown source ginnie"},
+		{name: "bad window", specs: specsMap{"mtgFields": full, "window": "0"}, wantErr: "illegal window"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mtg, e := tt.specs.mtgFields()
+			if tt.wantErr != "" {
+				if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+					t.Fatalf("mtgFields() error = %v, want %q", e, tt.wantErr)
+				}
+
+				return
+			}
+
+			if e != nil {
+				t.Fatalf("mtgFields() error = %v", e)
+			}
+
+			pass2, e := tt.specs.pass2Fields()
+			if e != nil {
+				t.Fatalf("pass2Fields() error = %v", e)
+			}
+
+			if mtg != tt.mtg || pass2 != tt.pass2 {
+				t.Errorf("mtgFields(), pass2Fields() = %q, %q, want %q, %q", mtg, pass2, tt.mtg, tt.pass2)
+			}
+		})
+	}
+}
+
+func TestSourceLoadedOnce(t *testing.T) {
+	dir := t.TempDir()
+	for _, frag := range sourceFragments {
+		if e := os.WriteFile(filepath.Join(dir, frag+".sql"), []byte(frag), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	specs := specsMap{"mtgFields": dir}
+	if _, e := specs.goodLoan(); e != nil {
+		t.Fatal(e)
+	}
+
+	if e := os.WriteFile(filepath.Join(dir, "goodLoan.sql"), []byte("changed"), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	if got, e := specs.goodLoan(); e != nil || got != "goodLoan" {
+		t.Errorf("goodLoan() = %q, %v, want the fragment first loaded", got, e)
+	}
+}
+
+func TestPassQueries(t *testing.T) {
+	for _, src := range []string{fannie, freddie, tape} {
+		t.Run(src, func(t *testing.T) {
+			specs := specsMap{"mtgFields": src, "mtgDb": "mtg.loans", "pass1Sample": "tmp.s1", "where1": "fico > 700",
+				"where2": "AND ltv < 80", "pass2Sample": "tmp.s2", "outTable": "tmp.model", "econDb": "econ.final",
+				"econFields": "zip3", "econFallback": "msa, national"}
+
+			qry1, e := pass1Query(specs)
+			if e != nil {
+				t.Fatalf("pass1Query() error = %v", e)
+			}
+
+			qry2, e := pass2Query(specs)
+			if e != nil {
+				t.Fatalf("pass2Query() error = %v", e)
+			}
+
+			qry3, _, e := pass3Query(specs)
+			if e != nil {
+				t.Fatalf("pass3Query() error = %v", e)
+			}
+
+			// the unmatched rows of the econ joins are found by their default month, whatever join_use_nulls is
+			if ind := strings.Index(qry3, "SETTINGS join_use_nulls = 0"); ind < strings.LastIndex(qry3, "LEFT JOIN") ||
+				ind > strings.Index(qry3, "SELECT * FROM d") {
+				t.Errorf("pass 3 query doesn't set join_use_nulls to 0 for the econ joins:\n%s", qry3)
+			}
+
+			for _, c := range []struct {
+				qry string
+				has []string
+			}{
+				{qry1, []string{"mtg.loans", "AND fico > 700", "SELECT * FROM d"}},
+				{qry2, []string{"mtg.loans", "tmp.s1", "AND ltv < 80", "ARRAY JOIN monthly AS mon"}},
+				{qry3, []string{"tmp.s2", "tmp.modelEconMsa", "multiIf(", "econLevel"}},
+			} {
+				for _, s := range c.has {
+					if !strings.Contains(c.qry, s) {
+						t.Errorf("query doesn't have %q:\n%s", s, c.qry)
+					}
+				}
+
+				for _, ph := range []string{"<fields>", "<goodLoan>", "<where>", "<mtgDb>", "<pass1Sample>"} {
+					if strings.Contains(c.qry, ph) {
+						t.Errorf("query has placeholder %s", ph)
+					}
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,10 +15,6 @@ import (
 )
 
 const (
-	// BYOD
-	fannie  = "fannie"
-	freddie = "freddie"
-
 	// default values
 	plotWidth  = 1600.0
 	plotHeight = 1200.0
@@ -59,6 +57,8 @@ func (sf specsMap) check() error {
 		requiredAssess = "assessQuery"
 
 		requiredBias = "biasQuery, biasDir"
+
+		requiredScore = "scoreQuery, saveTable, saveTableTargets"
 	)
 
 	// see if all the keys are valid keys
@@ -68,14 +68,15 @@ func (sf specsMap) check() error {
 
 	reqs := required
 
-	if !sf.buildData() && !sf.buildModel() && !sf.biasCorrect() && !sf.assessModel() {
+	if !sf.buildData() && !sf.buildModel() && !sf.biasCorrect() && !sf.assessModel() && !sf.scoreModel() {
 		return fmt.Errorf("nothing to do")
 	}
 
 	// check required keys
-	for ind, todo := range []bool{sf.buildData(), sf.buildModel(), sf.biasCorrect(), sf.assessModel()} {
+	for ind, todo := range []bool{sf.buildData(), sf.buildModel(), sf.biasCorrect(), sf.assessModel(), sf.scoreModel()} {
 		if todo {
-			reqs = joinString(reqs, strings.ReplaceAll([]string{requiredData, requiredModel, requiredBias, requiredAssess}[ind], " ", ""))
+			reqs = joinString(reqs, strings.ReplaceAll([]string{requiredData, requiredModel, requiredBias,
+				requiredAssess, requiredScore}[ind], " ", ""))
 		}
 	}
 
@@ -90,6 +91,14 @@ func (sf specsMap) check() error {
 		return e
 	}
 
+	if _, e := sf.keepRuns(); e != nil {
+		return e
+	}
+
+	if _, e := sf.assessWorkers(); e != nil {
+		return e
+	}
+
 	if e := sf.checkInputModels(); e != nil {
 		return e
 	}
@@ -150,7 +159,7 @@ func (sf specsMap) getQuery(table string) string {
 // <base>Target<shortName>: <targetStr>
 // <base>Slice<shortName>: <feature>
 //
-// <base> can be: curves or assess,
+// <base> can be: curves or assess, <targetStr> is a list of output columns, ranges of columns and groups
 //
 // Example:
 // assessNameState: Property State
@@ -186,15 +195,10 @@ func (sf specsMap) slicer(base string) []slices {
 			item = slices{name: k, feature: "", targetStr: "", target: nil}
 			return append(vals, item)
 		}
-		spl := toSlice(targetStr, ",")
-		trgs := make([]int, 0)
-		for _, trg := range spl {
-			i, e := strconv.ParseInt(strings.ReplaceAll(trg, " ", ""), base10, bits32)
-			if e != nil {
-				item = slices{name: k, feature: "", targetStr: "", target: nil}
-				return append(vals, item)
-			}
-			trgs = append(trgs, int(i))
+		trgs, e := sf.targets(targetStr)
+		if e != nil {
+			item = slices{name: k, feature: "", targetStr: "", target: nil}
+			return append(vals, item)
 		}
 		item = slices{
 			name:      v,
@@ -206,6 +210,9 @@ func (sf specsMap) slicer(base string) []slices {
 		vals = append(vals, item)
 	}
 
+	// order by key so the output is the same from run to run
+	sort.Slice(vals, func(i, j int) bool { return vals[i].shortName < vals[j].shortName })
+
 	return vals
 }
 
@@ -281,11 +288,29 @@ func (sf specsMap) earlyStopping() (int, error) {
 	return 0, fmt.Errorf("missing earlyStopping key")
 }
 
+// assessWorkers returns the number of curves and assessments to run at once.  The default is 1.
+func (sf specsMap) assessWorkers() (int, error) {
+	workStr, ok := sf["assessWorkers"]
+	if !ok {
+		return 1, nil
+	}
+
+	workers, e := strconv.ParseInt(strings.ReplaceAll(workStr, " ", ""), base10, bits32)
+	if e != nil || workers <= 0 {
+		return 0, fmt.Errorf("assessWorkers must be a positive integer, got %s", workStr)
+	}
+
+	return int(workers), nil
+}
+
 // plotShow returns true if the user wants to show all the plots in a browser, too.
 func (sf specsMap) plotShow() bool {
-	show, ok := sf["plotShow"]
+	show, ok := sf["show"]
 	if !ok {
-		return plotShow
+		// the old name of show
+		if show, ok = sf["plotShow"]; !ok {
+			return plotShow
+		}
 	}
 	return show == yes
 }
@@ -308,7 +333,7 @@ func (sf specsMap) gDir(dirType string, sl *slices) (path string, err error) {
 
 // plotWidth returns plot width (in pixels)
 func (sf specsMap) plotWidth() float64 {
-	pw, ok := sf["PlotWidth"]
+	pw, ok := sf["plotWidth"]
 	if !ok {
 		return plotWidth
 	}
@@ -321,7 +346,7 @@ func (sf specsMap) plotWidth() float64 {
 
 // plotHeight returns plot height (in pixels)
 func (sf specsMap) plotHeight() float64 {
-	pw, ok := sf["PlotHeight"]
+	pw, ok := sf["plotHeight"]
 	if !ok {
 		return plotHeight
 	}
@@ -339,10 +364,11 @@ func (sf specsMap) plotHeight() float64 {
 //
 // In the specs file, this looks like:
 //
+//	group d120p: 4-12
 //	saveTable: mtg.outDqT12
-//	saveTableTargets: d120:4,5,6,7,8,9,10,11,12; d30:1
+//	saveTableTargets: d120p; d30{1}
 //
-// The assess data is saved to mtg.outDqT12.  It will have two extra fields: d120 and d30.  D120 is the sum
+// The assess data is saved to mtg.outDqT12.  It will have two extra fields: d120p and d30.  d120p is the sum
 // of columns 4-12 of the model output, and d30 is column 1.
 func (sf specsMap) saveTable() (tableName string, fields []string, targets [][]int, err error) {
 	table, ok := sf["saveTable"]
@@ -356,33 +382,164 @@ func (sf specsMap) saveTable() (tableName string, fields []string, targets [][]i
 		return table, nil, nil, nil
 	}
 
-	fields = make([]string, 0)
-	targets = make([][]int, 0)
+	groups, err := sf.targetGroups()
+	if err != nil {
+		return "", nil, nil, err
+	}
 
-	fts := strings.Split(fTargs, ";")
-	for _, ft := range fts {
-		fldTarg := strings.Split(ft, "{")
-		if len(fldTarg) != 2 {
-			return "", nil, nil, fmt.Errorf("cannot parse saveTableTargets: %s", fTargs)
+	if fields, targets, err = fieldTargets(fTargs, groups); err != nil {
+		return "", nil, nil, fmt.Errorf("cannot parse saveTableTargets: %v", err)
+	}
+
+	return table, fields, targets, nil
+}
+
+// checkOutputs checks that the targets of the assessments, curves and saveTableTargets are among the nCol output
+// columns of the model.
+func (sf specsMap) checkOutputs(nCol int) error {
+	_, fields, targets, e := sf.saveTable()
+	if e != nil {
+		return e
+	}
+
+	for _, sl := range append(sf.slicer("curves"), sf.slicer("assess")...) {
+		fields, targets = append(fields, sl.shortName), append(targets, sl.target)
+	}
+
+	for ind, trgs := range targets {
+		for _, trg := range trgs {
+			if trg >= nCol {
+				return fmt.Errorf("%s: target %d is not an output of the model, which has outputs 0 to %d",
+					fields[ind], trg, nCol-1)
+			}
 		}
+	}
+
+	return nil
+}
 
-		field := fldTarg[0]
-		targsStr := strings.Split(fldTarg[1], ",")
-		targs := make([]int, 0)
+// groupPattern matches the names of target groups.
+var groupPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
 
-		for _, targStr := range targsStr {
-			targ, e := strconv.ParseInt(strings.ReplaceAll(strings.ReplaceAll(targStr, " ", ""), "}", ""), base10, bits32)
-			if e != nil {
-				return "", nil, nil, fmt.Errorf("cannot ParseInt targets %s", targsStr)
+// targetGroups returns the named groups of model output columns.  They are given in the specs file as
+//
+//	group <name>: <targets>
+//
+// where the targets are columns and ranges of columns, e.g. "group d120p: 4-12".  Since spaces are dropped from keys,
+// the key is group<name>.  A group may be used wherever targets are listed, in place of the columns.
+func (sf specsMap) targetGroups() (map[string][]int, error) {
+	groups := make(map[string][]int)
+
+	for key, val := range sf {
+		if !strings.HasPrefix(key, "group") {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, "group")
+		if !groupPattern.MatchString(name) {
+			return nil, fmt.Errorf("%s: a group is given as group <name>: <targets>, e.g. group d120p: 4-12", key)
+		}
+
+		trgs, e := parseTargets(toSlice(val, ","), nil)
+		if e != nil {
+			return nil, fmt.Errorf("group %s: %v", name, e)
+		}
+
+		groups[name] = trgs
+	}
+
+	return groups, nil
+}
+
+// targets returns the output columns of the list of targets val, such as "1, 4-12" or "d120p".
+func (sf specsMap) targets(val string) ([]int, error) {
+	groups, e := sf.targetGroups()
+	if e != nil {
+		return nil, e
+	}
+
+	return parseTargets(toSlice(val, ","), groups)
+}
+
+// parseTargets returns the output columns of items.  Each item is a column, a range of columns (e.g. 4-12) or the
+// name of one of groups.
+func parseTargets(items []string, groups map[string][]int) ([]int, error) {
+	trgs := make([]int, 0)
+
+	for _, item := range items {
+		if group, ok := groups[item]; ok {
+			trgs = append(trgs, group...)
+			continue
+		}
+
+		if lo, hi, ok := strings.Cut(item, "-"); ok {
+			first, e1 := strconv.Atoi(lo)
+			last, e2 := strconv.Atoi(hi)
+			if e1 != nil || e2 != nil || first < 0 || first > last {
+				return nil, fmt.Errorf("bad range %s, must be <first>-<last>", item)
+			}
+
+			for trg := first; trg <= last; trg++ {
+				trgs = append(trgs, trg)
 			}
-			targs = append(targs, int(targ))
+
+			continue
+		}
+
+		trg, e := strconv.Atoi(item)
+		if e != nil {
+			return nil, fmt.Errorf("%s is not an output column, a range of columns or a group", item)
+		}
+
+		if trg < 0 {
+			return nil, fmt.Errorf("output columns start at 0, got %d", trg)
+		}
+
+		trgs = append(trgs, trg)
+	}
+
+	return trgs, nil
+}
+
+// splitFieldTargets splits a list of fields and their targets, such as "d120p{4-12}; d90{3}", into the fields and
+// the items of their targets.  A field on its own, such as "d120p", is a group and its targets are the group.
+func splitFieldTargets(val string) (fields []string, items [][]string, err error) {
+	for _, ft := range strings.Split(val, ";") {
+		fldTarg := strings.Split(ft, "{")
+		field := strings.TrimSpace(fldTarg[0])
+
+		switch {
+		case len(fldTarg) == 1 && groupPattern.MatchString(field):
+			items = append(items, []string{field})
+		case len(fldTarg) != 2 || !strings.HasSuffix(strings.TrimSpace(fldTarg[1]), "}"):
+			return nil, nil, fmt.Errorf("must be <field>{<target>, <target>...}; ..., got %s", val)
+		default:
+			items = append(items, toSlice(strings.TrimSuffix(strings.TrimSpace(fldTarg[1]), "}"), ","))
 		}
 
-		targets = append(targets, targs)
 		fields = append(fields, field)
 	}
 
-	return table, fields, targets, nil
+	return fields, items, nil
+}
+
+// fieldTargets parses a list of fields and their targets, such as "d120p{4-12}; d90{3}".  The targets may use groups.
+func fieldTargets(val string, groups map[string][]int) (fields []string, targets [][]int, err error) {
+	fields, items, err := splitFieldTargets(val)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for ind, item := range items {
+		trgs, e := parseTargets(item, groups)
+		if e != nil {
+			return nil, nil, fmt.Errorf("%s: %v", fields[ind], e)
+		}
+
+		targets = append(targets, trgs)
+	}
+
+	return fields, targets, nil
 }
 
 func (sf specsMap) checkInputModels() error {
@@ -711,6 +868,27 @@ func (sf specsMap) assessModel() bool {
 	return false
 }
 
+// scoreModel returns true if scoreModel: key is yes
+func (sf specsMap) scoreModel() bool {
+	if val, ok := sf["scoreModel"]; ok {
+		return val == yes
+	}
+
+	return false
+}
+
+// setStages sets the stage keys (buildData, buildModel, biasCorrect, assessModel, scoreModel) in stages to yes and
+// the rest to no.
+func (sf specsMap) setStages(stages ...string) {
+	for _, key := range stageKeys {
+		sf[key] = no
+	}
+
+	for _, key := range stages {
+		sf[key] = yes
+	}
+}
+
 // graphsKey returns the value of the graphs: key. The user may specify a directory name other
 // than "graphs" for the graphs directory.
 func (sf specsMap) graphsKey() string {
@@ -745,7 +923,7 @@ func (sf specsMap) findFeatures(modelDir string, top bool) error {
 		return e
 	}
 
-	// see what is in here.  If there are files, we process those before recursing down
+	// see what is in here.  If there is a model, we process that before recursing down
 	hasFiles := false
 	hasDir := false
 	for _, entry := range dirList {
@@ -754,7 +932,10 @@ func (sf specsMap) findFeatures(modelDir string, top bool) error {
 		case true:
 			hasDir = true
 		case false:
-			hasFiles = true
+			// other files (e.g. provenance.json) may be present before the model is built
+			if entry.Name() == "fieldDefs.jsn" {
+				hasFiles = true
+			}
 		}
 	}
 
@@ -879,8 +1060,113 @@ func (sf specsMap) haveFeature(feature string) bool {
 	return false
 }
 
-// readSpecsMap reads the .gom and creates the specMap.
-func readSpecsMap(specFile string) (specsMap, error) {
+// readSpecsMap reads the .gom file and creates the specsMap.  The line each key is on is recorded, so errors can
+// point to it.  Included files are read, too (see gomFile.read).  The ${name} references in the values are replaced,
+// vars are the values given on the command line (see gomFile.interpolate).
+func readSpecsMap(specFile string, vars map[string]string) (*gomFile, error) {
+	gf := newGomFile(specFile)
+	if e := gf.read(specFile, nil); e != nil {
+		return nil, e
+	}
+
+	if e := gf.interpolate(vars); e != nil {
+		return nil, e
+	}
+
+	return gf, nil
+}
+
+// gomLine is a key and value as read from a .gom file.
+type gomLine struct {
+	key  string
+	val  string
+	line int
+}
+
+// read reads the keys of specFile into gf.  stack is the chain of files that include specFile.
+//
+// "include: <file>" reads the keys of another .gom file.  A relative path is relative to the directory of specFile.
+// Included files are read before the keys of specFile, so:
+//   - the keys of specFile replace those of the files it includes;
+//   - if two included files set a key, the one included last is used.
+//
+// A key that is repeated, such as inputModel, is replaced as a whole: if specFile sets inputModel, none of the
+// inputModels of the files it includes are used.
+func (gf *gomFile) read(specFile string, stack []string) error {
+	abs, e := filepath.Abs(specFile)
+	if e != nil {
+		return e
+	}
+	stack = append(append([]string{}, stack...), abs)
+
+	var kvs []gomLine
+	switch isStructured(specFile) {
+	case true:
+		kvs, e = readStructured(specFile)
+	case false:
+		kvs, e = readGomLines(specFile)
+	}
+
+	if e != nil {
+		return e
+	}
+
+	for _, kv := range kvs {
+		if kv.key != "include" {
+			continue
+		}
+
+		inc := strings.TrimSpace(kv.val)
+		if inc == "" {
+			return fmt.Errorf("%s:%d: include: missing file", specFile, kv.line)
+		}
+
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(specFile), inc)
+		}
+
+		incAbs, e := filepath.Abs(inc)
+		if e != nil {
+			return e
+		}
+
+		if ind := searchSlice(incAbs, stack); ind >= 0 {
+			return fmt.Errorf("%s:%d: include: cycle %s -> %s", specFile, kv.line, strings.Join(stack[ind:], " -> "), incAbs)
+		}
+
+		if e := gf.read(inc, stack); e != nil {
+			return e
+		}
+
+		gf.includes = append(gf.includes, inc)
+	}
+
+	// some keys might have duplicates: "inputModels" may, for instance.  These are numbered within the file, after
+	// the keys of the same name from the included files are dropped.
+	mine := make(map[string]bool)
+	for _, kv := range kvs {
+		if kv.key == "include" {
+			continue
+		}
+
+		if !mine[kv.key] {
+			gf.drop(kv.key)
+		}
+
+		key := kv.key
+		for ind := 1; mine[key]; ind++ {
+			key = fmt.Sprintf("%s%d", kv.key, ind)
+		}
+		mine[key] = true
+
+		gf.add(key, kv.key, kv.val, specFile, kv.line)
+	}
+
+	return nil
+}
+
+// readGomLines returns the keys and values of specFile in the order they appear.
+func readGomLines(specFile string) ([]gomLine, error) {
 	handle, e := os.Open(specFile)
 	if e != nil {
 		return nil, e
@@ -889,11 +1175,12 @@ func readSpecsMap(specFile string) (specsMap, error) {
 
 	rdr := bufio.NewReader(handle)
 
-	sMap := make(specsMap)
+	kvs := make([]gomLine, 0)
 	line, nextLine := "", ""
+	lineNo, keyLine, nextKeyLine := 0, 0, 0
 
 	for {
-		nextLine = line
+		nextLine, nextKeyLine = line, keyLine
 
 		for {
 			if line, e = rdr.ReadString('\n'); e == io.EOF {
@@ -905,6 +1192,7 @@ func readSpecsMap(specFile string) (specsMap, error) {
 				return nil, e
 			}
 
+			lineNo++
 			line = strings.TrimLeft(strings.TrimRight(line, "\n"), " ")
 
 			if line == "" || len(line) < 2 {
@@ -923,35 +1211,30 @@ func readSpecsMap(specFile string) (specsMap, error) {
 			}
 
 			if strings.Contains(nextLine, ":") && strings.Contains(line, ":") {
+				keyLine = lineNo
 				break
 			}
 
+			if nextLine == "" {
+				nextKeyLine = lineNo
+			}
+
 			nextLine = fmt.Sprintf("%s %s", nextLine, line)
 		}
 
 		kv := strings.SplitN(nextLine, ":", 2)
 		if len(kv) != 2 {
-			return nil, fmt.Errorf("bad key val: %s in specs file %s", nextLine, specFile)
+			return nil, fmt.Errorf("%s:%d: bad key val: %s", specFile, nextKeyLine, strings.TrimSpace(nextLine))
 		}
 
-		base := strings.ReplaceAll(kv[0], " ", "")
-		key := base
-
-		// some keys might have duplicates: "inputModels" may, for instance
-		ind := 0
-		for _, ok := sMap[key]; ok; _, ok = sMap[key] {
-			ind++
-			key = fmt.Sprintf("%s%d", base, ind)
-		}
-
-		sMap[key] = strings.TrimLeft(kv[1], " ")
+		kvs = append(kvs, gomLine{key: strings.ReplaceAll(kv[0], " ", ""), val: strings.TrimLeft(kv[1], " "), line: nextKeyLine})
 
 		if e == io.EOF {
 			break
 		}
 	}
 
-	return sMap, nil
+	return kvs, nil
 }
 
 // getWhere returns the "WHERE" clause for the pass
@@ -981,119 +1264,3 @@ func (sf specsMap) windowExtras() {
 
 	sf["arrayJoin"] = ""
 }
-
-// The methods below deal with specific data sources (e.g. fannie)
-
-// mtgFields returns the Pass3 goMortgage fields from the data source specified in the specs field <mtgFields>
-// BYOD
-func (sf specsMap) mtgFields() string {
-	switch sf["mtgFields"] {
-	case fannie:
-		if w, _ := sf.window(); w > 0 {
-			return fannieMtgFieldsStat
-		}
-		return fmt.Sprintf("%s, %s", fannieMtgFieldsStat, fannieMtgFieldsMon)
-	case freddie:
-		if w, _ := sf.window(); w > 0 {
-			return freddieMtgFieldsStat
-		}
-		return fmt.Sprintf("%s, %s", freddieMtgFieldsStat, freddieMtgFieldsMon)
-	default:
-		return ""
-	}
-}
-
-// goodLoan returns the Pass1 WHERE clause for the data source the restricts selections to loans that pass QA.
-// BYOD
-func (sf specsMap) goodLoan() string {
-	switch sf["mtgFields"] {
-	case fannie:
-		return fannieGoodLoan
-	case freddie:
-		return freddieGoodLoan
-	default:
-		return ""
-	}
-}
-
-// pass1Fields returns the Pass1 fields for the data source.
-// BYOD
-func (sf specsMap) pass1Fields() string {
-	switch sf["mtgFields"] {
-	case fannie:
-		return fanniePass1
-	case freddie:
-		return freddiePass1
-	default:
-		return ""
-	}
-}
-
-// pass2Fields returns the Pass2 fields for the data source.
-// BYOD
-func (sf specsMap) pass2Fields() string {
-	switch sf["mtgFields"] {
-	case fannie:
-		if window, _ := sf.window(); window == 0 {
-			return fanniePass2Fields
-		} else {
-			return fanniePass2FieldsWindow
-		}
-	case freddie:
-		if window, _ := sf.window(); window == 0 {
-			return freddiePass2Fields
-		} else {
-			return freddiePass2FieldsWindow
-		}
-	default:
-		return ""
-	}
-}
-
-// pass3Fields returns the Pass3 fields for the data source.
-// BYOD
-func (sf specsMap) pass3Fields() string {
-	switch sf["mtgFields"] {
-	case fannie:
-		return fanniePass3Calcs
-	case freddie:
-		return freddiePass3Calcs
-	default:
-		return ""
-	}
-}
-
-// econJoin is called for pass3 which joins the sampled goMortgage data to economic data.
-// The returns are
-//
-//   - table : WITH statement that generates the econ data.
-//   - fields: field list of econ fields to return from query
-//
-// Economic data is pulled at 3 time periods per loan:
-//
-//   - first pay date
-//   - as-of date
-//   - target date
-//
-// To accommodate this, the field list has the form:
-//
-//	<corr><base field> AS <pre><base field>
-//
-// where <base field> is the root field (e.g. HPI), <corr> is the correlation for the table (since it's joined 3 times)
-// and <pre> is a prefix (org, ao, trg)
-func (sf specsMap) econJoin() (table, fields string) {
-	var fieldList string
-	switch sf["econFields"] {
-	case "zip3":
-		table, fieldList = econTable3, econFields3 // these are embedded files
-	default:
-		return "", ""
-	}
-
-	fields3 := make([]string, 0)
-	fields3 = append(fields3, strings.ReplaceAll(strings.ReplaceAll(fieldList, "<corr>", "b."), "<pre>", "trg"),
-		strings.ReplaceAll(strings.ReplaceAll(fieldList, "<corr>", "c."), "<pre>", "ao"),
-		strings.ReplaceAll(strings.ReplaceAll(fieldList, "<corr>", "d."), "<pre>", "org"),
-		strings.ReplaceAll(strings.ReplaceAll(fieldList, "<corr>", "x2020."), "<pre>", "y20"))
-	return table, strings.Join(fields3, ",")
-}
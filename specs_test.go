@@ -0,0 +1,272 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSpecsMap(t *testing.T) {
+	t.Setenv("GOM_TEST_DIR", "/data")
+
+	tests := []struct {
+		name    string
+		files   map[string]string // spec files by name, main.gom is read
+		vars    map[string]string // -set values
+		want    map[string]string // keys and their values
+		absent  []string          // keys that must not be set
+		wantErr string            // part of the error
+	}{
+		{
+			name:  "plain",
+			files: map[string]string{"main.gom": "title: dq model\n// comment\nouterTable: tmp.a // trailing\n"},
+			want:  map[string]string{"title": "dq model", "outerTable": "tmp.a"},
+		},
+		{
+			name: "continued value",
+			files: map[string]string{
+				"main.gom": "cts: fico,\n  ltv,\n  dti\ntitle: x\n",
+			},
+			want: map[string]string{"cts": "fico, ltv, dti", "title": "x"},
+		},
+		{
+			name: "include precedence",
+			files: map[string]string{
+				"main.gom":   "include: a.gom\ninclude: sub/b.gom\ntitle: main\n",
+				"a.gom":      "title: a\nouterTable: a\nwindow: 3\n",
+				"sub/b.gom":  "outerTable: b\ninclude: c.gom\n",
+				"sub/c.gom":  "window: 6\ncts: fico\n",
+				"unused.gom": "title: unused\n",
+			},
+			want: map[string]string{"title": "main", "outerTable": "b", "window": "6", "cts": "fico"},
+		},
+		{
+			name: "repeated key replaced as a whole",
+			files: map[string]string{
+				"main.gom": "include: a.gom\ninputModel: m3\n",
+				"a.gom":    "inputModel: m1\ninputModel: m2\nlocationm1: /m1\n",
+			},
+			want:   map[string]string{"inputModel": "m3", "locationm1": "/m1"},
+			absent: []string{"inputModel1"},
+		},
+		{
+			name: "repeated key from the last include",
+			files: map[string]string{
+				"main.gom": "include: a.gom\ninclude: b.gom\n",
+				"a.gom":    "inputModel: m1\ninputModel: m2\ninputModel: m3\n",
+				"b.gom":    "inputModel: m4\ninputModel: m5\n",
+			},
+			want:   map[string]string{"inputModel": "m4", "inputModel1": "m5"},
+			absent: []string{"inputModel2"},
+		},
+		{
+			name: "repeated key in main only",
+			files: map[string]string{
+				"main.gom": "include: a.gom\ninputModel: m1\ninputModel: m2\n",
+				"a.gom":    "title: a\n",
+			},
+			want: map[string]string{"inputModel": "m1", "inputModel1": "m2", "title": "a"},
+		},
+		{
+			name: "include structured",
+			files: map[string]string{
+				"main.gom": "include: a.yaml\n",
+				"a.yaml":   "title: from yaml\n",
+			},
+			want: map[string]string{"title": "from yaml"},
+		},
+		{
+			name: "include cycle",
+			files: map[string]string{
+				"main.gom": "include: a.gom\n",
+				"a.gom":    "include: main.gom\n",
+			},
+			wantErr: "cycle",
+		},
+		{
+			name:    "include missing file",
+			files:   map[string]string{"main.gom": "include:\n"},
+			wantErr: "missing file",
+		},
+		{
+			name: "references",
+			files: map[string]string{
+				"main.gom": "model: Dq\nouterTable: tmp.model${model}\npass1Sample: ${outerTable}1\noutDir: ${GOM_TEST_DIR}/${model}\n",
+			},
+			want: map[string]string{"outerTable": "tmp.modelDq", "pass1Sample": "tmp.modelDq1", "outDir": "/data/Dq"},
+		},
+		{
+			name:  "set value",
+			files: map[string]string{"main.gom": "model: Dq\nouterTable: tmp.${model}${run}\n"},
+			vars:  map[string]string{"run": "2", "model": "Prepay"},
+			want:  map[string]string{"outerTable": "tmp.Prepay2"},
+		},
+		{
+			name:  "reference to included key",
+			files: map[string]string{"main.gom": "include: a.gom\nouterTable: ${db}.dq\n", "a.gom": "db: tmp\n"},
+			want:  map[string]string{"outerTable": "tmp.dq"},
+		},
+		{
+			name:    "undefined reference",
+			files:   map[string]string{"main.gom": "outerTable: ${nowhere}\n"},
+			wantErr: "undefined reference ${nowhere}",
+		},
+		{
+			name:    "reference cycle",
+			files:   map[string]string{"main.gom": "a: ${b}\nb: ${a}\n"},
+			wantErr: "reference cycle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, text := range tt.files {
+				path := filepath.Join(dir, name)
+				if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+					t.Fatal(e)
+				}
+
+				if e := os.WriteFile(path, []byte(text), 0644); e != nil {
+					t.Fatal(e)
+				}
+			}
+
+			gf, e := readSpecsMap(filepath.Join(dir, "main.gom"), tt.vars)
+			if tt.wantErr != "" {
+				if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+					t.Fatalf("readSpecsMap() error = %v, want %q", e, tt.wantErr)
+				}
+
+				return
+			}
+
+			if e != nil {
+				t.Fatalf("readSpecsMap() error = %v", e)
+			}
+
+			for key, want := range tt.want {
+				if got := gf.specsMap[key]; got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+
+			for _, key := range tt.absent {
+				if got, ok := gf.specsMap[key]; ok {
+					t.Errorf("%s = %q, want it unset", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	groups := map[string][]int{"d120p": {4, 5, 6}, "cur": {0}}
+
+	tests := []struct {
+		name    string
+		items   []string
+		want    []int
+		wantErr string // part of the error
+	}{
+		{name: "column", items: []string{"3"}, want: []int{3}},
+		{name: "range", items: []string{"1-3"}, want: []int{1, 2, 3}},
+		{name: "one-column range", items: []string{"2-2"}, want: []int{2}},
+		{name: "mixed", items: []string{"0", "2-3", "9"}, want: []int{0, 2, 3, 9}},
+		{name: "group", items: []string{"d120p"}, want: []int{4, 5, 6}},
+		{name: "group and columns", items: []string{"cur", "1-2", "d120p"}, want: []int{0, 1, 2, 4, 5, 6}},
+		{name: "reversed range", items: []string{"3-1"}, wantErr: "bad range 3-1"},
+		{name: "open range", items: []string{"3-"}, wantErr: "bad range 3-"},
+		{name: "negative", items: []string{"-1"}, wantErr: "bad range -1"},
+		{name: "unknown group", items: []string{"d90"}, wantErr: "d90 is not an output column"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := parseTargets(tt.items, groups)
+			if tt.wantErr != "" {
+				if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+					t.Errorf("parseTargets(%v) error = %v, want %q", tt.items, e, tt.wantErr)
+				}
+
+				return
+			}
+
+			if e != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTargets(%v) = %v, %v, want %v", tt.items, got, e, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   specsMap
+		want    map[string][]int
+		wantErr string // part of the error
+	}{
+		{name: "none", specs: specsMap{"target": "targetDq"}, want: map[string][]int{}},
+		{name: "groups", specs: specsMap{"groupd120p": "4-6", "groupcur": "0", "groupdq": "1, 2-3"},
+			want: map[string][]int{"d120p": {4, 5, 6}, "cur": {0}, "dq": {1, 2, 3}}},
+		{name: "bad name", specs: specsMap{"group1x": "1"}, wantErr: "group <name>"},
+		{name: "reversed range", specs: specsMap{"groupd": "6-4"}, wantErr: "group d: bad range 6-4"},
+		{name: "group of groups", specs: specsMap{"groupd": "4", "groupe": "d"}, wantErr: "group e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := tt.specs.targetGroups()
+			if tt.wantErr != "" {
+				if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+					t.Errorf("targetGroups() error = %v, want %q", e, tt.wantErr)
+				}
+
+				return
+			}
+
+			if e != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targetGroups() = %v, %v, want %v", got, e, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   specsMap
+		nCol    int
+		wantErr string // part of the error
+	}{
+		{name: "in range", specs: specsMap{"saveTable": "tmp.out", "saveTableTargets": "prepay{1}; d120p",
+			"groupd120p": "2-3"}, nCol: 4},
+		{name: "save target out of range", specs: specsMap{"saveTable": "tmp.out", "saveTableTargets": "prepay{4}"},
+			nCol: 4, wantErr: "prepay: target 4 is not an output of the model, which has outputs 0 to 3"},
+		{name: "group out of range", specs: specsMap{"saveTable": "tmp.out", "saveTableTargets": "d120p",
+			"groupd120p": "2-5"}, nCol: 4, wantErr: "d120p: target 4"},
+		{name: "assess target out of range", specs: specsMap{"assessNamex": "x", "assessTargetx": "1-2",
+			"assessSlicerx": "noGroups"}, nCol: 2, wantErr: "x: target 2"},
+		{name: "continuous", specs: specsMap{"assessNamex": "x", "assessTargetx": "0", "assessSlicerx": "noGroups"},
+			nCol: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.specs.checkOutputs(tt.nCol)
+			if tt.wantErr == "" {
+				if e != nil {
+					t.Errorf("checkOutputs(%d) error = %v", tt.nCol, e)
+				}
+
+				return
+			}
+
+			if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+				t.Errorf("checkOutputs(%d) error = %v, want %q", tt.nCol, e, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// fields calculated at each anchor date of the econAnchors key.  < pre > is the name of the anchor (e.g. y20).
+// constant dollar propVal
+propVal * (<pre>Hpi / orgHpi) AS <pre>PropVal
@@ -0,0 +1,22 @@
+// econ table is at the zip level.  This aggregates to the state level
+eState AS (
+    SELECT
+        state,
+        month,
+        avg(zip3Hpi) AS hpi,
+        sum(unempRate * lbrForce) / sum(lbrForce) AS unempRate,
+        sum(lbrForce) AS lbrForceTot,
+        max(mortFix30) AS mortFix30,
+        max(mortFix15) AS mortFix15,
+        max(treas10) AS treas10,
+        avg(q10) AS income10,
+        avg(q25) AS income25,
+        avg(q50) AS income50,
+        avg(q75) AS income75,
+        avg(q90) AS income90,
+        max(state) AS msaNameLoc,
+        max(fcDays) AS fcDays,
+        max(fcType) AS fcType
+  FROM
+    <econDb>
+GROUP BY state, month)
\ No newline at end of file
@@ -1,5 +1,5 @@
 // econ table is at the zip level.  This aggregates to the zip3 level
-WITH e AS (
+eZip3 AS (
     SELECT
         zip3,
         month,
@@ -18,5 +18,5 @@ WITH e AS (
         max(fcDays) AS fcDays,
         max(fcType) AS fcType
   FROM
-    econGo.final
+    <econDb>
 GROUP BY zip3, month)
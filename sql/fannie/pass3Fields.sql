@@ -2,8 +2,7 @@
 100.0 * (trgHpi / orgHpi - 1) AS trgdHpi,
 propVal * (trgHpi / orgHpi) AS trgPropVal,
 propVal * (aoHpi / orgHpi) AS aoPropVal,
-// constant dollar propVal (20200101)
-propVal * (y20Hpi / orgHpi) AS y20PropVal,
+// constant dollar propVal at the anchor dates (e.g. y20PropVal) is in econ/anchorFields.sql
 
 100 * aoUpb / aoPropVal AS aoEltv,
 100 * trgUpbExp / trgPropVal AS trgEltv,
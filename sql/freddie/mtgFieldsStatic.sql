@@ -3,6 +3,7 @@ lns.fpDt,
 lns.firstTime,
 lns.matDt,
 lns.msaD,
+lns.msaD AS msa,
 lns.mi,
 lns.units,
 lns.occ,
@@ -1,33 +1,21 @@
 // pass3 is a skeleton statement that defines the final table
-// < with > is an additional with statement that defines the economic data
-// < fields > are the fields to keep from tables b, c, d plus additional calculations
+// < dates > are the anchor dates of econAnchors (e.g. y20Dt) and the dates lagged by econLags (e.g. aoDtLag2) the
+// econ data is pulled at, each preceded by a comma
+// < fields > are the fields to keep from the econ joins plus additional calculations
 // < pass2Sample > is the table created by pass2
-// < econFields > is the field to join on (e.g. zip, zip3)
-<with>,
-d AS (
+// < joins > joins the econ data at each geo level and date (see pass3Join.sql).  pass3 builds the econ data at each
+// level in a table first.
+// < econMatch > keeps the loans that have econ data at every date
+// The econ joins are LEFT JOINs.  econMatch and the econ fallback find the unmatched rows by their default month, so
+// join_use_nulls is set to 0 here whatever the server or profile sets.
+WITH d AS (
   SELECT
     a.*,
-    b.msaNameLoc AS msaLocName,
     <fields>
   FROM
-    <pass2Sample> AS a
-  JOIN
-    e AS b
-  ON
-    a.trgDt = b.month
-    AND a.<econFields> = b.<econFields>
-  JOIN
-    e AS c
-  ON
-    a.aoDt = c.month
-    AND a.<econFields> = c.<econFields>
-  JOIN
-    e AS d
-  ON
-    a.fpDt = d.month
-    AND a.<econFields> = d.<econFields>
-  JOIN
-    (SELECT * FROM e WHERE e.month = toDate('2020-01-01')) AS x2020
-  ON
-    a.<econFields> = x2020.<econFields>
-)
\ No newline at end of file
+    (SELECT * <dates> FROM <pass2Sample>) AS a
+  <joins>
+  WHERE
+    <econMatch>
+  SETTINGS join_use_nulls = 0
+)
@@ -0,0 +1,13 @@
+// pass3Join joins the econ data at one geo level to the pass 2 sample at one date.  It's a LEFT JOIN so that a loan
+// with no econ data at the level can fall back to the next level of econFallback.
+// < econ > is the table with the econ data at the geo level
+// < corr > is the correlation of the join: b (target date), c (as-of date), d (first-pay date) or x and the anchor
+// name (e.g. xY20) for an anchor date, with the lag for a date lagged by econLags (e.g. cLag2).  It's followed by the
+// level, except for the default level of econFields.
+// < date > is the date field of the pass 2 sample to join on
+// < geo > is the field to join on (e.g. zip3, state).  A level with no geo field (national) joins on the date alone.
+  LEFT JOIN
+    <econ> AS <corr>
+  ON
+    a.<date> = <corr>.month
+    AND a.<geo> = <corr>.<geo>
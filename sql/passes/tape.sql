@@ -0,0 +1,25 @@
+// tape is a skeleton statement that builds the loan-level table from a loan tape with one row per loan-month
+// < tape > is the loan tape: a table or a ClickHouse table function that reads a file
+// < rawFields > converts the columns of the tape to the types of the fields
+// < tapeFields > fills in missing values and flags the values that fail QA
+// < fields > are the fields of the loan-level table. The monthly values of each loan are grouped into arrays.
+WITH r AS (
+  SELECT
+    <rawFields>
+  FROM
+    <tape> AS t
+),
+m AS (
+  SELECT
+    <tapeFields>
+  FROM
+    r
+),
+d AS (
+  SELECT
+    <fields>
+  FROM
+    m
+  GROUP BY
+    tapeLnId
+)
\ No newline at end of file
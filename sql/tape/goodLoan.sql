@@ -0,0 +1,15 @@
+// requirements for a loan to be considered for the sample.  The QA fields are calculated when the tape is loaded.
+has(qa.field,'month') = 0
+AND has(qa.field,'fpDt') = 0
+AND has(qa.field,'term') = 0
+AND has(qa.field,'rate') = 0
+AND has(qa.field,'state') = 0
+AND has(qa.field,'fico') = 0
+AND has(qa.field,'ltv') = 0
+AND has(allFail,'dq') = 0
+AND has(qa.field,'zip3') = 0
+AND has(allFail,'curRate') = 0
+AND has(allFail,'upb') = 0
+AND has(qa.field,'propVal') = 0
+AND has(qa.field, 'numBorr') = 0
+AND aoRemTerm > 0
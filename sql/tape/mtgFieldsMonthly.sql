@@ -0,0 +1,9 @@
+// fields from the loan tape table
+mon.month AS trgDt,
+mon.upb AS trgUpbAct,
+mon.dq AS trgDq,
+mon.curRate AS trgRate,
+mon.mod AS trgMod,
+mon.zb AS trgZb,
+mon.bap AS trgBap,
+mon.ageFpDt AS trgAge
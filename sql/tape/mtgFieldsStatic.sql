@@ -0,0 +1,24 @@
+// fields from the loan tape table
+lns.lnId,
+lns.fpDt,
+lns.term,
+lns.rate,
+lns.ltv,
+lns.cltv,
+lns.dti,
+lns.fico,
+lns.numBorr,
+lns.firstTime,
+lns.purpose,
+lns.propType,
+lns.units,
+lns.occ,
+lns.channel,
+lns.state,
+lns.msa,
+lns.zip3,
+lns.zip,
+lns.county,
+lns.propVal,
+lns.pPen,
+lns.fclProNet
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A spec file may be YAML or JSON rather than .gom.  The keys are the same as in a .gom file, but lists and the
+// nested keys are written natively:
+//
+//	cat: [propType, occ, nsDoc]
+//	layers:
+//	  - FC(size:20, activation:relu)
+//	  - FC(size:3, activation:softmax)
+//	emb: {fcstMonth: 2}
+//	groups: {d120p: [4-12]}
+//	saveTableTargets: {prepay: [1], default: [2], d120p: [d120p]}
+//	inputModels:
+//	  Dq: {location: /home/user/goMortgage/dq, targets: {d120: [4, 5, 6], current: [0]}}
+//	assess:
+//	  aoDqPp: {name: Prepay, target: [1], slicer: aoDqCap6}
+//
+// The file is converted to the keys of the equivalent .gom file, so both formats are read into the same specsMap.
+
+// listKeys are the .gom keys whose values are comma-separated lists.
+var listKeys = []string{"strats1", "strats2", "cat", "cts", "addlCat", "addlKeep", "assessAddl"}
+
+// slicerParts are the parts of an assessment or curve, as keys in a structured spec and in a .gom file.
+var slicerParts = [][2]string{{"name", "Name"}, {"target", "Target"}, {"slicer", "Slicer"}}
+
+// isStructured returns true if fileName is a YAML or JSON spec file.
+func isStructured(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+
+	return false
+}
+
+// nodeError is an error in a value of a structured spec file.
+type nodeError struct {
+	line int
+	msg  string
+}
+
+func (ne *nodeError) Error() string {
+	return ne.msg
+}
+
+// nodeErrorf returns a nodeError for the node n.
+func nodeErrorf(n *yaml.Node, format string, args ...any) error {
+	return &nodeError{line: n.Line, msg: fmt.Sprintf(format, args...)}
+}
+
+// readStructured returns the keys and values of the YAML or JSON spec file specFile, as .gom keys, in the order
+// they appear.
+func readStructured(specFile string) ([]gomLine, error) {
+	buf, e := os.ReadFile(specFile)
+	if e != nil {
+		return nil, e
+	}
+
+	doc := &yaml.Node{}
+	if er := yaml.Unmarshal(buf, doc); er != nil {
+		return nil, fmt.Errorf("%s: %v", specFile, er)
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: must be a map of keys to values", specFile)
+	}
+
+	kvs := make([]gomLine, 0)
+	root := doc.Content[0]
+
+	for ind := 0; ind < len(root.Content); ind += 2 {
+		key, val := root.Content[ind], resolve(root.Content[ind+1])
+
+		add, er := structuredKey(key.Value, key.Line, val)
+		if er != nil {
+			ne := &nodeError{}
+			if errors.As(er, &ne) {
+				return nil, fmt.Errorf("%s:%d: %s: %s", specFile, ne.line, key.Value, ne.msg)
+			}
+
+			return nil, er
+		}
+
+		kvs = append(kvs, add...)
+	}
+
+	return kvs, nil
+}
+
+// resolve returns the node an alias refers to.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	return n
+}
+
+// structuredKey returns the .gom keys of the structured key on line with value val.
+func structuredKey(key string, line int, val *yaml.Node) ([]gomLine, error) {
+	kvs := make([]gomLine, 0)
+	add := func(k, v string) {
+		kvs = append(kvs, gomLine{key: k, val: v, line: line})
+	}
+
+	switch key {
+	case "layers":
+		if val.Kind != yaml.SequenceNode {
+			return nil, nodeErrorf(val, "must be a list of layers")
+		}
+
+		for ind, layer := range val.Content {
+			v, e := scalar(layer)
+			if e != nil {
+				return nil, e
+			}
+			add(fmt.Sprintf("layer%d", ind+1), v)
+		}
+	case "emb", "saveTableTargets":
+		v, e := targetMap(val)
+		if e != nil {
+			return nil, e
+		}
+		add(key, v)
+	case "inputModels":
+		e := eachEntry(val, func(name string, model *yaml.Node) error {
+			add("inputModel", name)
+			return eachEntry(model, func(part string, pv *yaml.Node) error {
+				var v string
+				var e error
+
+				switch part {
+				case "location":
+					v, e = scalar(pv)
+				case "targets":
+					v, e = targetMap(pv)
+				default:
+					return nodeErrorf(pv, "unknown key %s, must be location or targets", part)
+				}
+
+				add(part+name, v)
+
+				return e
+			})
+		})
+		if e != nil {
+			return nil, e
+		}
+	case "assess", "curves":
+		e := eachEntry(val, func(shortName string, sl *yaml.Node) error {
+			return eachEntry(sl, func(part string, pv *yaml.Node) error {
+				for _, sp := range slicerParts {
+					if part == sp[0] {
+						v, e := list(pv)
+						add(key+sp[1]+shortName, v)
+
+						return e
+					}
+				}
+
+				return nodeErrorf(pv, "unknown key %s, must be name, target or slicer", part)
+			})
+		})
+		if e != nil {
+			return nil, e
+		}
+	case "groups":
+		e := eachEntry(val, func(name string, trgs *yaml.Node) error {
+			v, e := list(trgs)
+			add("group"+name, v)
+
+			return e
+		})
+		if e != nil {
+			return nil, e
+		}
+	case "include":
+		if val.Kind != yaml.SequenceNode {
+			v, e := scalar(val)
+			add(key, v)
+
+			return kvs, e
+		}
+
+		for _, inc := range val.Content {
+			v, e := scalar(inc)
+			if e != nil {
+				return nil, e
+			}
+			add(key, v)
+		}
+	default:
+		v, e := list(val)
+		if e != nil {
+			return nil, e
+		}
+		add(key, v)
+	}
+
+	return kvs, nil
+}
+
+// eachEntry calls fn for each entry of the map n.
+func eachEntry(n *yaml.Node, fn func(key string, val *yaml.Node) error) error {
+	if n.Kind != yaml.MappingNode {
+		return nodeErrorf(n, "must be a map")
+	}
+
+	for ind := 0; ind < len(n.Content); ind += 2 {
+		if e := fn(n.Content[ind].Value, resolve(n.Content[ind+1])); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// scalar returns the value of the scalar n.  Multi-line values are joined with spaces, as they are in .gom files.
+func scalar(n *yaml.Node) (string, error) {
+	n = resolve(n)
+	if n.Kind != yaml.ScalarNode {
+		return "", nodeErrorf(n, "must be a value")
+	}
+
+	switch n.Tag {
+	case "!!null":
+		return "", nil
+	case "!!bool":
+		if b, _ := strconv.ParseBool(n.Value); b {
+			return yes, nil
+		}
+
+		return no, nil
+	}
+
+	return strings.TrimSpace(strings.Join(strings.Split(n.Value, "\n"), " ")), nil
+}
+
+// list returns the value of n, which may be a scalar or a list of scalars.  A list is returned comma-separated.
+func list(n *yaml.Node) (string, error) {
+	if n.Kind != yaml.SequenceNode {
+		return scalar(n)
+	}
+
+	vals := make([]string, 0)
+	for _, item := range n.Content {
+		v, e := scalar(item)
+		if e != nil {
+			return "", e
+		}
+		vals = append(vals, v)
+	}
+
+	return strings.Join(vals, ", "), nil
+}
+
+// targetMap returns the map n of fields to targets as a .gom value, e.g. "d120{4,5,6}; current{0}".  n may also be
+// the .gom value itself.
+func targetMap(n *yaml.Node) (string, error) {
+	if n.Kind == yaml.ScalarNode {
+		return scalar(n)
+	}
+
+	vals := make([]string, 0)
+	e := eachEntry(n, func(field string, targets *yaml.Node) error {
+		v, e := list(targets)
+		vals = append(vals, fmt.Sprintf("%s{%s}", field, v))
+
+		return e
+	})
+
+	return strings.Join(vals, "; "), e
+}
+
+// convertGom writes the .gom file specFile to w as YAML.  Comments are not carried over.
+func convertGom(specFile string, w io.Writer) error {
+	kvs, e := readGomLines(specFile)
+	if e != nil {
+		return e
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, HeadComment: fmt.Sprintf("converted from %s", specFile)}
+
+	// groups holds the nodes of the nested keys, which are placed where their first key is
+	groups := make(map[string]*yaml.Node)
+	group := func(key string, kind yaml.Kind) *yaml.Node {
+		if g, ok := groups[key]; ok {
+			return g
+		}
+
+		g := &yaml.Node{Kind: kind}
+		root.Content = append(root.Content, str(key), g)
+		groups[key] = g
+
+		return g
+	}
+
+	models := make(map[string]bool)
+	layers := make(map[int]*yaml.Node)
+
+	for _, kv := range kvs {
+		if kv.key == "inputModel" {
+			models[strings.TrimSpace(kv.val)] = true
+		}
+	}
+
+	for _, kv := range kvs {
+		key, val := kv.key, strings.TrimSpace(kv.val)
+
+		if num, ok := layerNum(key); ok {
+			layers[num] = str(val)
+			group("layers", yaml.SequenceNode)
+			continue
+		}
+
+		if base, shortName, part := slicerKey(key); base != "" {
+			sl := entry(group(base, yaml.MappingNode), shortName)
+			if part == "target" {
+				sl.Content = append(sl.Content, str(part), listNode(val))
+				continue
+			}
+
+			sl.Content = append(sl.Content, str(part), str(val))
+			continue
+		}
+
+		if part, name := modelKey(key, models); part != "" {
+			m := entry(group("inputModels", yaml.MappingNode), name)
+			if part == "location" {
+				m.Content = append(m.Content, str(part), str(val))
+				continue
+			}
+
+			m.Content = append(m.Content, str(part), targetsNode(val))
+			continue
+		}
+
+		switch {
+		case key == "inputModel":
+			entry(group("inputModels", yaml.MappingNode), val)
+		case key == "include":
+			g := group(key, yaml.SequenceNode)
+			g.Content = append(g.Content, str(val))
+		case strings.HasPrefix(key, "group"):
+			g := group("groups", yaml.MappingNode)
+			g.Content = append(g.Content, str(strings.TrimPrefix(key, "group")), listNode(val))
+		case key == "emb" || key == "saveTableTargets":
+			root.Content = append(root.Content, str(key), targetsNode(val))
+		case searchSlice(key, listKeys) >= 0:
+			root.Content = append(root.Content, str(key), listNode(val))
+		default:
+			root.Content = append(root.Content, str(key), str(val))
+		}
+	}
+
+	nums := make([]int, 0)
+	for num := range layers {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	for _, num := range nums {
+		groups["layers"].Content = append(groups["layers"].Content, layers[num])
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if e := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); e != nil {
+		return e
+	}
+
+	return enc.Close()
+}
+
+// str returns a scalar node with value val.
+func str(val string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: val}
+}
+
+// listNode returns the comma-separated val as a flow-style list.
+func listNode(val string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+	for _, item := range toSlice(val, ",") {
+		n.Content = append(n.Content, str(item))
+	}
+
+	return n
+}
+
+// targetsNode returns a list of fields and their targets, such as "d120{4-12}; current{0}", as a flow-style map.
+// If val can't be parsed, it is returned as is.
+func targetsNode(val string) *yaml.Node {
+	fields, items, e := splitFieldTargets(val)
+	if e != nil {
+		return str(val)
+	}
+
+	n := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+	for ind, field := range fields {
+		trgs := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range items[ind] {
+			trgs.Content = append(trgs.Content, str(item))
+		}
+
+		n.Content = append(n.Content, str(field), trgs)
+	}
+
+	return n
+}
+
+// entry returns the map that is the value of key in the map n, adding it if needed.
+func entry(n *yaml.Node, key string) *yaml.Node {
+	for ind := 0; ind < len(n.Content); ind += 2 {
+		if n.Content[ind].Value == key {
+			return n.Content[ind+1]
+		}
+	}
+
+	m := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+	n.Content = append(n.Content, str(key), m)
+
+	return m
+}
+
+// layerNum returns the number of the layer key layer<n>.
+func layerNum(key string) (int, bool) {
+	if !strings.HasPrefix(key, "layer") {
+		return 0, false
+	}
+
+	num, e := strconv.Atoi(strings.TrimPrefix(key, "layer"))
+
+	return num, e == nil
+}
+
+// slicerKey splits an assessment or curve key, such as assessTargetaoDq, into its base (assess), short name (aoDq)
+// and part (target).  base is empty if key is not one of these.
+func slicerKey(key string) (base, shortName, part string) {
+	for _, b := range []string{"assess", "curves"} {
+		for _, sp := range slicerParts {
+			if prefix := b + sp[1]; strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+				return b, strings.TrimPrefix(key, prefix), sp[0]
+			}
+		}
+	}
+
+	return "", "", ""
+}
+
+// modelKey splits an input model key, such as locationDq, into its part (location) and model (Dq).  part is empty
+// if key is not one of these.
+func modelKey(key string, models map[string]bool) (part, name string) {
+	for _, p := range []string{"location", "targets"} {
+		if strings.HasPrefix(key, p) && models[strings.TrimPrefix(key, p)] {
+			return p, strings.TrimPrefix(key, p)
+		}
+	}
+
+	return "", ""
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestReadStructured(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // name of the spec file
+		text    string
+		want    []gomLine
+		wantErr string // part of the error
+	}{
+		{
+			name: "yaml",
+			file: "dq.yaml",
+			text: "title: dq model\ncat: [purpose, occ]\nshow: true\nwindow: 3\n" +
+				"layers:\n  - FC(size:20, activation:relu)\n  - FC(size:3, activation:softmax)\n",
+			want: []gomLine{{"title", "dq model", 1}, {"cat", "purpose, occ", 2}, {"show", yes, 3},
+				{"window", "3", 4}, {"layer1", "FC(size:20, activation:relu)", 5},
+				{"layer2", "FC(size:3, activation:softmax)", 5}},
+		},
+		{
+			name: "json",
+			file: "dq.json",
+			text: `{"title": "dq model", "cts": ["fico", "ltv"], "buildData": false, "emb": {"fcstMonth": 2},` + "\n" +
+				`"groups": {"d120p": ["4-12"]}}`,
+			want: []gomLine{{"title", "dq model", 1}, {"cts", "fico, ltv", 1}, {"buildData", no, 1},
+				{"emb", "fcstMonth{2}", 1}, {"groupd120p", "4-12", 2}},
+		},
+		{
+			name: "nested",
+			file: "dq.yml",
+			text: "inputModels:\n  Dq: {location: /models/dq, targets: {d120: [4, 5], current: [0]}}\n" +
+				"assess:\n  aoDq: {name: Prepay, target: [1], slicer: aoDqCap6}\n" +
+				"include: [a.gom, b.yaml]\n",
+			want: []gomLine{{"inputModel", "Dq", 1}, {"locationDq", "/models/dq", 1},
+				{"targetsDq", "d120{4, 5}; current{0}", 1}, {"assessNameaoDq", "Prepay", 3},
+				{"assessTargetaoDq", "1", 3}, {"assessSliceraoDq", "aoDqCap6", 3}, {"include", "a.gom", 5},
+				{"include", "b.yaml", 5}},
+		},
+		{
+			name: "anchors and aliases",
+			file: "dq.yaml",
+			text: "fc: &fc FC(size:20, activation:relu)\nlayers: [*fc, *fc]\n" +
+				"curves:\n  noGroups: &part {name: All, target: [1], slicer: noGroups}\n  again: *part\n" +
+				"strats1: &strats [purpose, state]\nstrats2: *strats\n",
+			want: []gomLine{{"fc", "FC(size:20, activation:relu)", 1}, {"layer1", "FC(size:20, activation:relu)", 2},
+				{"layer2", "FC(size:20, activation:relu)", 2}, {"curvesNamenoGroups", "All", 3},
+				{"curvesTargetnoGroups", "1", 3}, {"curvesSlicernoGroups", "noGroups", 3},
+				{"curvesNameagain", "All", 3}, {"curvesTargetagain", "1", 3}, {"curvesSliceragain", "noGroups", 3},
+				{"strats1", "purpose, state", 6}, {"strats2", "purpose, state", 7}},
+		},
+		{
+			name: "multi-line value",
+			file: "dq.yaml",
+			text: "modelQuery: >\n  SELECT %s\n  FROM tmp.model\nwhere1: |\n  fico > 700\n  AND ltv < 80\n",
+			want: []gomLine{{"modelQuery", "SELECT %s FROM tmp.model", 1}, {"where1", "fico > 700 AND ltv < 80", 4}},
+		},
+		{name: "not a map", file: "dq.yaml", text: "- a\n- b\n", wantErr: "dq.yaml: must be a map of keys to values"},
+		{name: "bad yaml", file: "dq.yaml", text: "title: [a\n", wantErr: "dq.yaml: yaml:"},
+		{name: "layers not a list", file: "dq.yaml", text: "title: x\nlayers: FC(size:1)\n",
+			wantErr: "dq.yaml:2: layers: must be a list of layers"},
+		{name: "list of lists", file: "dq.yaml", text: "title: x\ncat:\n  - [a, b]\n",
+			wantErr: "dq.yaml:3: cat: must be a value"},
+		{name: "map value", file: "dq.json", text: "{\"title\": {\"a\": 1}}", wantErr: "dq.json:1: title: must be a value"},
+		{name: "inputModels not a map", file: "dq.yaml", text: "inputModels: [Dq]\n",
+			wantErr: "dq.yaml:1: inputModels: must be a map"},
+		{name: "unknown model part", file: "dq.yaml", text: "inputModels:\n  Dq:\n    loc: /models/dq\n",
+			wantErr: "dq.yaml:3: inputModels: unknown key loc, must be location or targets"},
+		{name: "unknown slicer part", file: "dq.yaml", text: "assess:\n  aoDq:\n    name: x\n    slice: y\n",
+			wantErr: "dq.yaml:4: assess: unknown key slice, must be name, target or slicer"},
+		{name: "bad target map", file: "dq.yaml", text: "title: x\nemb: [a, b]\n", wantErr: "dq.yaml:2: emb: must be a map"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specFile := filepath.Join(t.TempDir(), tt.file)
+			if e := os.WriteFile(specFile, []byte(tt.text), 0644); e != nil {
+				t.Fatal(e)
+			}
+
+			got, e := readStructured(specFile)
+			if tt.wantErr != "" {
+				if e == nil || !strings.Contains(e.Error(), tt.wantErr) {
+					t.Fatalf("readStructured() error = %v, want %q", e, tt.wantErr)
+				}
+
+				return
+			}
+
+			if e != nil {
+				t.Fatalf("readStructured() error = %v", e)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readStructured() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructuredKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		val      string // YAML of the value
+		want     []gomLine
+		wantLine int // line of the bad node, 0 if the value is good
+	}{
+		{name: "scalar", key: "epochs", val: "100", want: []gomLine{{"epochs", "100", 9}}},
+		{name: "null", key: "where1", val: "null", want: []gomLine{{"where1", "", 9}}},
+		{name: "include", key: "include", val: "common.gom", want: []gomLine{{"include", "common.gom", 9}}},
+		{name: "groups", key: "groups", val: "{d: [4-6], c: 0}", want: []gomLine{{"groupd", "4-6", 9}, {"groupc", "0", 9}}},
+		{name: "save targets", key: "saveTableTargets", val: "{prepay: [1], d120p: [d120p]}",
+			want: []gomLine{{"saveTableTargets", "prepay{1}; d120p{d120p}", 9}}},
+		{name: "bad layer", key: "layers", val: "- FC(size:2)\n- {size: 2}", wantLine: 2},
+		{name: "bad group", key: "groups", val: "d:\n  x: 1", wantLine: 2},
+		{name: "bad include", key: "include", val: "- a.gom\n- [b.gom]", wantLine: 2},
+		{name: "bad slicer", key: "curves", val: "noGroups: all", wantLine: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := structuredKey(tt.key, 9, yamlNode(t, tt.val))
+			if tt.wantLine > 0 {
+				ne, ok := e.(*nodeError)
+				if !ok || ne.line != tt.wantLine {
+					t.Fatalf("structuredKey() error = %#v, want a nodeError on line %d", e, tt.wantLine)
+				}
+
+				return
+			}
+
+			if e != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("structuredKey() = %v, %v, want %v", got, e, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		val     string // YAML of the value
+		want    string
+		wantErr bool
+	}{
+		{name: "map", val: "{d120: [4, 5, 6], current: [0]}", want: "d120{4, 5, 6}; current{0}"},
+		{name: "scalar targets", val: "{prepay: 1, d120p: d120p}", want: "prepay{1}; d120p{d120p}"},
+		{name: "range", val: "{d120p: [4-12]}", want: "d120p{4-12}"},
+		{name: "gom value", val: "d120{4,5}; current{0}", want: "d120{4,5}; current{0}"},
+		{name: "alias", val: "{a: &t [1, 2], b: *t}", want: "a{1, 2}; b{1, 2}"},
+		{name: "list", val: "[1, 2]", wantErr: true},
+		{name: "nested map", val: "{d120: {x: 1}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := targetMap(yamlNode(t, tt.val))
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("targetMap() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("targetMap() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertGom(t *testing.T) {
+	tests := []struct {
+		name string
+		gom  string
+	}{
+		{name: "plain", gom: "title: dq model\nepochs: 100\nmodelQuery: SELECT %s FROM tmp.model WHERE bucket < 10\n"},
+		{name: "lists", gom: "cat: purpose, occ,\n  nsDoc\ncts: fico, ltv\nstrats1: purpose, state\n" +
+			"emb: fcstMonth{2}; state{4}\n"},
+		{name: "layers", gom: "layer2: FC(size:3, activation:softmax)\nlayer1: FC(size:20, activation:relu)\n"},
+		{name: "assessments", gom: "assessNameaoDq: Prepay\nassessTargetaoDq: 1, 2-3\nassessSliceraoDq: aoDqCap6\n" +
+			"curvesNamenoGroups: All\ncurvesTargetnoGroups: d120p\ncurvesSlicernoGroups: noGroups\n"},
+		{name: "groups and targets", gom: "group d120p: 4-12\ngroup cur: 0\nsaveTable: tmp.out\n" +
+			"saveTableTargets: prepay{1}; d120p\n"},
+		{name: "input models", gom: "inputModel: Dq\nlocationDq: /models/dq\ntargetsDq: d120{4,5,6}; current{0}\n" +
+			"inputModel: Pp\nlocationPp: /models/pp\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			gomFile := filepath.Join(dir, "dq.gom")
+			if e := os.WriteFile(gomFile, []byte(tt.gom), 0644); e != nil {
+				t.Fatal(e)
+			}
+
+			buf := &bytes.Buffer{}
+			if e := convertGom(gomFile, buf); e != nil {
+				t.Fatalf("convertGom() error = %v", e)
+			}
+
+			yamlFile := filepath.Join(dir, "dq.yaml")
+			if e := os.WriteFile(yamlFile, buf.Bytes(), 0644); e != nil {
+				t.Fatal(e)
+			}
+
+			want, e := readSpecsMap(gomFile, nil)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			got, e := readSpecsMap(yamlFile, nil)
+			if e != nil {
+				t.Fatalf("reading the converted file: %v\n%s", e, buf)
+			}
+
+			// a group on its own, such as d120p, is written as d120p{d120p}, which has the same targets
+			_, gotFields, gotTargets, e1 := got.saveTable()
+			_, wantFields, wantTargets, e2 := want.saveTable()
+			if e1 != nil || e2 != nil || !reflect.DeepEqual(gotFields, wantFields) ||
+				!reflect.DeepEqual(gotTargets, wantTargets) {
+				t.Errorf("converted saveTableTargets = %v %v, %v, want %v %v, %v", gotFields, gotTargets, e1,
+					wantFields, wantTargets, e2)
+			}
+
+			delete(got.specsMap, "saveTableTargets")
+			delete(want.specsMap, "saveTableTargets")
+
+			if !reflect.DeepEqual(normalized(got.specsMap), normalized(want.specsMap)) {
+				t.Errorf("converted file = %v, want %v\n%s", got.specsMap, want.specsMap, buf)
+			}
+		})
+	}
+}
+
+// yamlNode returns the node of the YAML value text.
+func yamlNode(t *testing.T, text string) *yaml.Node {
+	t.Helper()
+
+	doc := &yaml.Node{}
+	if e := yaml.Unmarshal([]byte(text), doc); e != nil {
+		t.Fatal(e)
+	}
+
+	return doc.Content[0]
+}
+
+// normalized returns specs with the spaces dropped from the values, since lists are rewritten with a space after
+// each comma.
+func normalized(specs specsMap) map[string]string {
+	norm := make(map[string]string)
+	for k, v := range specs {
+		norm[k] = strings.ReplaceAll(v, " ", "")
+	}
+
+	return norm
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// sweep modes
+const (
+	sweepGrid = "grid" // every combination of the values
+	sweepList = "list" // the nth values of each key together
+)
+
+// sweepSummary is the name of the summary table in the sweep directory
+const sweepSummary = "summary.txt"
+
+// sweepSpec is a parameter sweep over a base .gom file.  The sweep file has the same format as a .gom file:
+//
+//	base: dq.gom
+//	sweep: grid
+//	outDir: /home/user/sweeps/dq/
+//	vary: l2Reg = 0.00001 | 0.0001 | 0.001
+//	vary: layer1 = FC(size:20, activation:relu) | FC(size:40, activation:relu)
+//
+// Each vary key gives a key of the base .gom file and its values, separated by "|".
+type sweepSpec struct {
+	base   string     // base .gom file
+	outDir string     // the variants are run in subdirectories of outDir
+	grid   bool       // true: every combination of values, false: the nth values together
+	keys   []string   // keys varied
+	values [][]string // values of each key
+}
+
+// variant is one run of a sweep.
+type variant struct {
+	name      string            // name of the variant, also the name of its directory (e.g. v001)
+	overrides map[string]string // values of the keys varied
+	ran       bool              // true if the variant was run
+	err       error             // error that stopped the run
+}
+
+// variantResult is the outcome of a variant, as read from its run directory.
+type variantResult struct {
+	bestEpoch int
+	costs     *fitCosts
+	metrics   map[string]float64 // overall KS and R-squared, keyed by <metric>:<assessment>
+}
+
+// readSweep reads the sweep file fileName.  vars are the values for ${name} references.
+func readSweep(fileName string, vars map[string]string) (*sweepSpec, error) {
+	sf, e := readSpecsMap(fileName, vars)
+	if e != nil {
+		return nil, e
+	}
+
+	sw := &sweepSpec{grid: true}
+
+	if sw.base = sf.getVal("base", false); sw.base == "" {
+		return nil, fmt.Errorf("sweep file %s: missing base key", fileName)
+	}
+
+	// the base file is relative to the sweep file
+	if !filepath.IsAbs(sw.base) {
+		sw.base = filepath.Join(filepath.Dir(fileName), sw.base)
+	}
+
+	switch mode := sf.getVal("sweep", false); mode {
+	case sweepGrid, "":
+	case sweepList:
+		sw.grid = false
+	default:
+		return nil, fmt.Errorf("sweep file %s: sweep must be %s or %s, got %s", fileName, sweepGrid, sweepList, mode)
+	}
+
+	if sw.outDir = sf.getVal("outDir", false); sw.outDir == "" {
+		base, e := readSpecsMap(sw.base, vars)
+		if e != nil {
+			return nil, e
+		}
+
+		sw.outDir = slash(base.getVal("outDir", false)) + "sweep"
+	}
+
+	sw.outDir = slash(strings.ReplaceAll(sw.outDir, " ", ""))
+
+	// duplicate keys are vary, vary1, vary2, ...
+	varyKeys := make([]string, 0)
+	for key := range sf.specsMap {
+		switch {
+		case key == "base", key == "sweep", key == "outDir":
+		case strings.HasPrefix(key, "vary"):
+			varyKeys = append(varyKeys, key)
+		default:
+			return nil, fmt.Errorf("sweep file %s: unknown key %s", fileName, key)
+		}
+	}
+
+	sort.Slice(varyKeys, func(i, j int) bool {
+		ni, _ := strconv.Atoi(varyKeys[i][len("vary"):])
+		nj, _ := strconv.Atoi(varyKeys[j][len("vary"):])
+		return ni < nj
+	})
+
+	for _, vk := range varyKeys {
+		kv := strings.SplitN(sf.getVal(vk, true), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("sweep file %s: vary must be <key> = <value> | <value> ..., got %s", fileName, sf.getVal(vk, true))
+		}
+
+		key := strings.ReplaceAll(kv[0], " ", "")
+		if key == "outDir" || searchSlice(key, sw.keys) >= 0 {
+			return nil, fmt.Errorf("sweep file %s: cannot vary %s", fileName, key)
+		}
+
+		vals := make([]string, 0)
+		for _, val := range strings.Split(kv[1], "|") {
+			if val = strings.TrimSpace(val); val == "" {
+				return nil, fmt.Errorf("sweep file %s: empty value for %s", fileName, key)
+			}
+			vals = append(vals, val)
+		}
+
+		if !sw.grid && len(sw.values) > 0 && len(vals) != len(sw.values[0]) {
+			return nil, fmt.Errorf("sweep file %s: list sweeps need the same number of values for each key", fileName)
+		}
+
+		sw.keys = append(sw.keys, key)
+		sw.values = append(sw.values, vals)
+	}
+
+	if len(sw.keys) == 0 {
+		return nil, fmt.Errorf("sweep file %s: no vary keys", fileName)
+	}
+
+	return sw, nil
+}
+
+// searchSlice returns the index of needle in haystack, -1 if it's not there.
+func searchSlice(needle string, haystack []string) int {
+	for ind, val := range haystack {
+		if val == needle {
+			return ind
+		}
+	}
+
+	return -1
+}
+
+// variants returns the variants of the sweep.  Grid sweeps vary the last key fastest.
+func (sw *sweepSpec) variants() []*variant {
+	combos := make([][]int, 0) // index into values for each key
+
+	switch sw.grid {
+	case true:
+		combos = append(combos, []int{})
+		for _, vals := range sw.values {
+			next := make([][]int, 0)
+			for _, combo := range combos {
+				for ind := range vals {
+					next = append(next, append(append([]int{}, combo...), ind))
+				}
+			}
+			combos = next
+		}
+	case false:
+		for ind := range sw.values[0] {
+			combo := make([]int, len(sw.keys))
+			for k := range combo {
+				combo[k] = ind
+			}
+			combos = append(combos, combo)
+		}
+	}
+
+	vars := make([]*variant, 0)
+	for num, combo := range combos {
+		v := &variant{name: fmt.Sprintf("v%03d", num+1), overrides: make(map[string]string)}
+		for k, ind := range combo {
+			v.overrides[sw.keys[k]] = sw.values[k][ind]
+		}
+
+		v.overrides["outDir"] = sw.outDir + v.name + "/"
+		vars = append(vars, v)
+	}
+
+	return vars
+}
+
+// sweep runs the variants of the sweep file opts.specsFile, one after the other, and writes a summary table
+// to the sweep directory.
+//
+// Only the first variant builds the data, the others use its tables.  So, keys that change the data can't be varied
+// and if the first variant fails to build the data, the sweep stops.
+func sweep(ctx context.Context, opts *runOpts) error {
+	sw, e := readSweep(opts.specsFile, opts.vars)
+	if e != nil {
+		return &usageError{e}
+	}
+
+	vars := sw.variants()
+
+	// check all the variants before running any of them.  The variants after the first are checked with buildData
+	// off, as they're run.
+	varOpts, buildsData := make([]*runOpts, len(vars)), false
+	for ind, v := range vars {
+		if ind > 0 && buildsData {
+			v.overrides["buildData"] = no
+		}
+
+		vo := *opts
+		vo.specsFile, vo.overrides = sw.base, v.overrides
+
+		specs, e := vo.loadSpecs(nil)
+		if e != nil {
+			return &usageError{fmt.Errorf("variant %s: %v", v.name, e)}
+		}
+
+		if ind == 0 && specs.buildData() {
+			buildsData = true
+			if e := sw.checkData(); e != nil {
+				return &usageError{e}
+			}
+		}
+
+		varOpts[ind] = &vo
+	}
+
+	if e := os.MkdirAll(sw.outDir, os.ModePerm); e != nil {
+		return e
+	}
+
+	if e := copyFile(opts.specsFile, sw.outDir+"sweep.gom"); e != nil {
+		return e
+	}
+
+	failed, stopped := 0, false
+	for ind, v := range vars {
+		fmt.Printf("sweep: running %s %s\n", v.name, v.describe(sw.keys))
+
+		v.ran = true
+		if v.err = runStages(ctx, nil, varOpts[ind]); v.err != nil {
+			failed++
+			fmt.Printf("sweep: %s failed: %v\n", v.name, v.err)
+		}
+
+		if stopped = errors.Is(v.err, errInterrupted); stopped {
+			break
+		}
+
+		// the other variants need the tables the first builds
+		if ind == 0 && buildsData && v.err != nil && !dataBuilt(v.overrides["outDir"]) {
+			fmt.Printf("sweep: %s did not build the data, stopping\n", v.name)
+			break
+		}
+	}
+
+	if opts.plan {
+		return nil
+	}
+
+	summary, e := os.Create(sw.outDir + sweepSummary)
+	if e != nil {
+		return e
+	}
+	defer func() { _ = summary.Close() }()
+
+	sw.summarize(vars, io.MultiWriter(os.Stdout, summary))
+
+	if stopped {
+		return errInterrupted
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d variants failed", failed, len(vars))
+	}
+
+	return nil
+}
+
+// checkData returns an error if a key varied changes the data.  Only the first variant builds the data, so the
+// others would silently use data built with its value.
+func (sw *sweepSpec) checkData() error {
+	for _, key := range sw.keys {
+		if key == "buildData" || searchSlice("buildData", stagesOf(key)) >= 0 {
+			return fmt.Errorf("cannot vary %s: only the first variant builds the data", key)
+		}
+	}
+
+	return nil
+}
+
+// dataBuilt returns true if the last run in outDir completed buildData.
+func dataBuilt(outDir string) bool {
+	man, e := loadManifest(runDir(outDir))
+
+	return e == nil && man.stage("buildData") != nil
+}
+
+// describe returns the values of the keys varied as key=value pairs.
+func (v *variant) describe(keys []string) string {
+	desc := make([]string, 0)
+	for _, key := range keys {
+		desc = append(desc, fmt.Sprintf("%s=%s", key, v.overrides[key]))
+	}
+
+	return strings.Join(desc, ", ")
+}
+
+// runDir returns the directory of the last run in outDir.  If the runs are versioned, this is the latest run.
+func runDir(outDir string) string {
+	if _, e := os.Lstat(outDir + latestRun); e == nil {
+		return outDir + latestRun + "/"
+	}
+
+	return outDir
+}
+
+// loadResult reads the result of the run in outDir from the model provenance and the JSON log.
+func loadResult(outDir string) (*variantResult, error) {
+	outDir = runDir(outDir)
+	res := &variantResult{metrics: make(map[string]float64)}
+
+	if prov, e := loadProvenance(outDir + "model"); e == nil {
+		res.bestEpoch, res.costs = prov.BestEpoch, prov.Costs
+	}
+
+	buf, e := os.ReadFile(outDir + "model.jsonl")
+	if e != nil {
+		return nil, e
+	}
+
+	// the overall KS and R-squared of each assessment.  If the run was resumed, the last value is used.
+	for _, line := range strings.Split(string(buf), "\n") {
+		rec := &logRecord{}
+		if json.Unmarshal([]byte(line), rec) != nil || rec.Event != "metric" || rec.Value == nil {
+			continue
+		}
+
+		if rec.Metric != "ks" && rec.Metric != "r2" {
+			continue
+		}
+
+		if _, ok := rec.Attrs["slicer"]; ok {
+			continue
+		}
+
+		res.metrics[fmt.Sprintf("%s:%v", rec.Metric, rec.Attrs["assessment"])] = *rec.Value
+	}
+
+	return res, nil
+}
+
+// summarize writes a table of the results of the variants to w.
+func (sw *sweepSpec) summarize(vars []*variant, w io.Writer) {
+	results := make([]*variantResult, len(vars))
+	metrics := make([]string, 0)
+
+	for ind, v := range vars {
+		res, e := loadResult(v.overrides["outDir"])
+		if e != nil {
+			continue
+		}
+
+		results[ind] = res
+		for m := range res.metrics {
+			if searchSlice(m, metrics) < 0 {
+				metrics = append(metrics, m)
+			}
+		}
+	}
+
+	sort.Strings(metrics)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := append(append([]string{"variant", "status", "bestEpoch", "validationCost"}, metrics...), sw.keys...)
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for ind, v := range vars {
+		status := "ok"
+		switch {
+		case !v.ran:
+			status = "not run"
+		case errors.Is(v.err, errInterrupted):
+			status = "interrupted"
+		case v.err != nil:
+			status = "failed"
+		}
+
+		row := []string{v.name, status, "-", "-"}
+		res := results[ind]
+
+		if res != nil && res.bestEpoch > 0 {
+			row[2] = fmt.Sprintf("%d", res.bestEpoch)
+		}
+
+		if res != nil && res.costs != nil {
+			row[3] = fmt.Sprintf("%0.5f", res.costs.ValidationBest)
+		}
+
+		for _, m := range metrics {
+			val := "-"
+			if res != nil {
+				if mv, ok := res.metrics[m]; ok {
+					val = fmt.Sprintf("%0.1f", mv)
+				}
+			}
+
+			row = append(row, val)
+		}
+
+		for _, key := range sw.keys {
+			row = append(row, v.overrides[key])
+		}
+
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	_ = tw.Flush()
+
+	for _, v := range vars {
+		if v.err != nil && !errors.Is(v.err, errInterrupted) {
+			_, _ = fmt.Fprintf(w, "\n%s: %v", v.name, v.err)
+		}
+	}
+
+	_, _ = fmt.Fprintln(w)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestVariantSaved(t *testing.T) {
+	outDir := t.TempDir() + "/"
+
+	tests := []struct {
+		name      string
+		overrides map[string]string
+	}{
+		{name: "key in the file", overrides: map[string]string{"outDir": outDir + "v001/", "learningRateStart": "0.0005"}},
+		{name: "key not in the file", overrides: map[string]string{"outDir": outDir + "v002/", "l2Reg": "0.5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &runOpts{specsFile: "scripts/dq.gom", vars: make(setVars), overrides: tt.overrides}
+
+			gf, e := opts.loadSpecs(nil)
+			if e != nil {
+				t.Fatalf("loadSpecs() error = %v", e)
+			}
+
+			saved := filepath.Join(t.TempDir(), "model.gom")
+			if e := gf.save(saved); e != nil {
+				t.Fatalf("save() error = %v", e)
+			}
+
+			back, e := readSpecsMap(saved, nil)
+			if e != nil {
+				t.Fatalf("readSpecsMap() error = %v", e)
+			}
+
+			for key, want := range tt.overrides {
+				if got := back.specsMap[key]; got != want {
+					t.Errorf("saved %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
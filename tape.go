@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/invertedv/chutils"
+	"github.com/invertedv/chutils/file"
+	s "github.com/invertedv/chutils/sql"
+)
+
+// A loan tape is a flat file of loan performance with one row per loan-month.  If the tapeFile key is given,
+// buildData loads the tape into mtgDb before pass 1.  mtgDb is built with the layout the passes expect: one row per
+// loan with the monthly performance in the nested table "monthly".  The QA results are also nested, in "qa", and
+// the monthly fields that fail every month are in allFail.  The "tape" data source selects and calculates fields from
+// this table.
+//
+// The tapeMap key maps the fields of mtgDb to the columns of the tape:
+//
+//	tapeMap: lnId=LOAN_ID, month=PERIOD, fpDt=FIRST_PAY_DATE, ...
+
+// tapeBatch is the number of rows inserted at a time when loading a .csv tape
+const tapeBatch = 100000
+
+// columnPattern is a tape column name that can be used as a ClickHouse column name
+var columnPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// tapeField is a field of the mtgDb table built from a loan tape.
+type tapeField struct {
+	name    string // name in mtgDb
+	kind    string // date, int, float or string
+	monthly bool   // the field is in the nested table "monthly"
+	deflt   string // value if the tape doesn't have the field or the value is missing, "" if the field is required
+	check   string // condition a good value meets.  %[1]s is the field.
+}
+
+// tapeFields are the fields of mtgDb, in order.  The monthly fields are together and ageFpDt, which is calculated, is
+// added to them.  The defaults may refer to other fields as tape<Field>.
+var tapeFields = []tapeField{
+	{name: "lnId", kind: "string"},
+	{name: "fpDt", kind: "date"},
+	{name: "term", kind: "int", check: "%[1]s BETWEEN 1 AND 480"},
+	{name: "rate", kind: "float", check: "%[1]s > 0 AND %[1]s < 25"},
+	{name: "ltv", kind: "float", check: "%[1]s > 0 AND %[1]s <= 200"},
+	{name: "cltv", kind: "float", deflt: "tapeLtv", check: "%[1]s > 0 AND %[1]s <= 200"},
+	{name: "dti", kind: "float", deflt: "0", check: "%[1]s >= 0 AND %[1]s <= 100"},
+	{name: "fico", kind: "int", check: "%[1]s BETWEEN 300 AND 850"},
+	{name: "numBorr", kind: "int", deflt: "1", check: "%[1]s BETWEEN 1 AND 10"},
+	{name: "firstTime", kind: "string", deflt: "'U'"},
+	{name: "purpose", kind: "string", deflt: "'U'"},
+	{name: "propType", kind: "string", deflt: "'U'"},
+	{name: "units", kind: "int", deflt: "1", check: "%[1]s BETWEEN 1 AND 4"},
+	{name: "occ", kind: "string", deflt: "'U'"},
+	{name: "channel", kind: "string", deflt: "'U'"},
+	{name: "state", kind: "string", check: "length(%[1]s) = 2"},
+	{name: "msa", kind: "string", deflt: "'00000'"},
+	{name: "zip3", kind: "string", check: "length(%[1]s) = 3"},
+	{name: "zip", kind: "string", deflt: "''", check: "length(%[1]s) = 5"},
+	{name: "county", kind: "string", deflt: "''"},
+	{name: "propVal", kind: "float", check: "%[1]s > 0"},
+	{name: "pPen", kind: "string", deflt: "'N'"},
+	{name: "fclProNet", kind: "float", deflt: "0"},
+	{name: "month", kind: "date", monthly: true},
+	{name: "upb", kind: "float", monthly: true, check: "%[1]s >= 0"},
+	{name: "dq", kind: "int", monthly: true, check: "%[1]s >= 0"},
+	{name: "curRate", kind: "float", monthly: true, deflt: "tapeRate", check: "%[1]s >= 0 AND %[1]s < 25"},
+	{name: "mod", kind: "string", monthly: true, deflt: "'N'"},
+	{name: "zb", kind: "string", monthly: true, deflt: "'00'"},
+	{name: "bap", kind: "string", monthly: true, deflt: "'N'"},
+	{name: "servicer", kind: "string", monthly: true, deflt: "'unknown'"},
+}
+
+// tapeConvert converts a tape column to the type of the field.  The result is NULL if the value is missing or
+// can't be converted.  Columns are converted from strings so that typed (parquet) and untyped (csv) tapes are
+// treated alike.
+var tapeConvert = map[string]string{
+	"date":   "toDate(parseDateTimeBestEffortOrNull(toString(t.%[1]s)))",
+	"int":    "toInt32OrNull(toString(t.%[1]s))",
+	"float":  "toFloat64OrNull(toString(t.%[1]s))",
+	"string": "nullIf(trim(toString(t.%[1]s)), '')",
+}
+
+// tapeTypes are the ClickHouse types of the kinds of fields
+var tapeTypes = map[string]string{
+	"date":   "Date",
+	"int":    "Int32",
+	"float":  "Float64",
+	"string": "String",
+}
+
+// tapeZero is the value of a required field that is missing.  The field fails QA.
+var tapeZero = map[string]string{
+	"date":   "'1970-01-01'",
+	"int":    "0",
+	"float":  "0",
+	"string": "''",
+}
+
+// loadsTape returns true if there is a loan tape to load.
+func (sf specsMap) loadsTape() bool {
+	_, ok := sf["tapeFile"]
+	return ok
+}
+
+// tapeParquet returns true if the tape is a parquet file.  Parquet files are read by the ClickHouse server.
+func (sf specsMap) tapeParquet() bool {
+	return strings.ToLower(filepath.Ext(sf["tapeFile"])) == ".parquet"
+}
+
+// tapeSeparator returns the field separator of a text tape: tab for .tsv and .txt files, otherwise comma.
+func (sf specsMap) tapeSeparator() rune {
+	switch strings.ToLower(filepath.Ext(sf["tapeFile"])) {
+	case ".tsv", ".txt":
+		return '\t'
+	default:
+		return ','
+	}
+}
+
+// tapeTables returns the tables loading the tape creates: the flat table the text tape is loaded into and mtgDb.
+func (sf specsMap) tapeTables() []string {
+	if sf.tapeParquet() {
+		return []string{sf.getVal("mtgDb", true)}
+	}
+
+	return []string{sf.tapeFlat(), sf.getVal("mtgDb", true)}
+}
+
+// tapeFlat returns the table a text tape is loaded into as is.
+func (sf specsMap) tapeFlat() string {
+	return sf.getVal("mtgDb", true) + "Flat"
+}
+
+// tapeMap returns the tape column of each field of mtgDb given by the tapeMap key.  Every field without a default
+// must be mapped.
+func (sf specsMap) tapeMap() (map[string]string, error) {
+	known := make(map[string]bool)
+	for _, fld := range tapeFields {
+		known[fld.name] = true
+	}
+
+	cols := make(map[string]string)
+	for _, item := range toSlice(sf["tapeMap"], ",") {
+		field, col, ok := strings.Cut(item, "=")
+		field, col = strings.TrimSpace(field), strings.TrimSpace(col)
+
+		if !ok || field == "" || col == "" {
+			return nil, fmt.Errorf("bad entry %s, must be field=column", item)
+		}
+
+		if !known[field] {
+			return nil, fmt.Errorf("unknown field %s", field)
+		}
+
+		if _, ok := cols[field]; ok {
+			return nil, fmt.Errorf("field %s is mapped twice", field)
+		}
+
+		if !columnPattern.MatchString(col) {
+			return nil, fmt.Errorf("column %s of field %s is not a legal column name", col, field)
+		}
+
+		cols[field] = col
+	}
+
+	missing := make([]string, 0)
+	for _, fld := range tapeFields {
+		if _, ok := cols[fld.name]; !ok && fld.deflt == "" {
+			missing = append(missing, fld.name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("required fields are not mapped: %s", strings.Join(missing, ", "))
+	}
+
+	return cols, nil
+}
+
+// checkTape checks the tape keys and that the columns tapeMap maps are in the header of a text tape.  Parquet tapes
+// are on the ClickHouse server, so their columns aren't checked.
+func (sf specsMap) checkTape() (key string, err error) {
+	if _, ok := sf["tapeMap"]; !ok {
+		return "tapeFile", fmt.Errorf("requires tapeMap")
+	}
+
+	if _, ok := sf["mtgDb"]; !ok {
+		return "tapeFile", fmt.Errorf("requires mtgDb, the table the tape is loaded into")
+	}
+
+	cols, e := sf.tapeMap()
+	if e != nil {
+		return "tapeMap", e
+	}
+
+	if sf.tapeParquet() {
+		return "", nil
+	}
+
+	header, e := tapeHeader(sf["tapeFile"], sf.tapeSeparator())
+	if e != nil {
+		return "tapeFile", e
+	}
+
+	missing := make([]string, 0)
+	for _, col := range cols {
+		if searchSlice(col, header) < 0 {
+			missing = append(missing, col)
+		}
+	}
+	sort.Strings(missing)
+
+	if len(missing) > 0 {
+		return "tapeMap", fmt.Errorf("columns not in %s: %s", sf["tapeFile"], strings.Join(missing, ", "))
+	}
+
+	return "", nil
+}
+
+// tapeReader opens a text tape.  The TableSpec has a String field for each column of the header.
+func tapeReader(fileName string, sep rune) (*file.Reader, error) {
+	handle, e := os.Open(fileName)
+	if e != nil {
+		return nil, e
+	}
+
+	rdr := file.NewReader(fileName, sep, '\n', '"', 0, 1, 0, handle, 0)
+	if e := rdr.Init("", chutils.MergeTree); e != nil {
+		_ = rdr.Close()
+		return nil, fmt.Errorf("cannot read the header of %s: %v", fileName, e)
+	}
+
+	for _, fd := range rdr.TableSpec().FieldDefs {
+		if !columnPattern.MatchString(fd.Name) {
+			_ = rdr.Close()
+			return nil, fmt.Errorf("column %s of %s is not a legal column name", fd.Name, fileName)
+		}
+
+		fd.ChSpec.Base = chutils.ChString
+	}
+
+	return rdr, nil
+}
+
+// tapeHeader returns the columns of a text tape.
+func tapeHeader(fileName string, sep rune) ([]string, error) {
+	rdr, e := tapeReader(fileName, sep)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = rdr.Close() }()
+
+	header := make([]string, len(rdr.TableSpec().FieldDefs))
+	for ind, fd := range rdr.TableSpec().FieldDefs {
+		header[ind] = fd.Name
+	}
+
+	return header, nil
+}
+
+// tapeQuery returns the query that builds mtgDb from the tape.  The query:
+//   - converts the mapped columns of the tape to the types of the fields (rawFields);
+//   - fills in the defaults and flags the values that fail QA (tapeFields);
+//   - groups the months of each loan and summarizes the QA (fields).
+//
+// The static fields are the values at the loan's first month on the tape.
+func tapeQuery(specs specsMap) (string, error) {
+	cols, e := specs.tapeMap()
+	if e != nil {
+		return "", e
+	}
+
+	raw, filled, fields, monthly := make([]string, 0), make([]string, 0), make([]string, 0), make([]string, 0)
+	qaNames, qaCounts, monthlyNames := make([]string, 0), make([]string, 0), make([]string, 0)
+
+	fields = append(fields, "tapeLnId AS lnId")
+
+	for _, fld := range tapeFields {
+		rName, tName := "raw"+capitalize(fld.name), "tape"+capitalize(fld.name)
+
+		col, mapped := cols[fld.name]
+		switch mapped {
+		case true:
+			raw = append(raw, fmt.Sprintf(tapeConvert[fld.kind]+" AS %[2]s", col, rName))
+
+			// a required field fails if it's missing.  A value that's there must pass the check.
+			deflt, bad := fld.deflt, "0"
+			switch deflt {
+			case "":
+				deflt, bad = tapeZero[fld.kind], fmt.Sprintf("isNull(%s)", rName)
+				if fld.check != "" {
+					bad = fmt.Sprintf("%s OR NOT (%s)", bad, fmt.Sprintf(fld.check, rName))
+				}
+			default:
+				if fld.check != "" {
+					bad = fmt.Sprintf("isNotNull(%s) AND NOT (%s)", rName, fmt.Sprintf(fld.check, rName))
+				}
+			}
+
+			filled = append(filled, fmt.Sprintf("ifNull(%s, CAST(%s AS %s)) AS %s", rName, deflt, tapeTypes[fld.kind], tName))
+			if bad != "0" {
+				bad = fmt.Sprintf("ifNull(%s, 1)", bad)
+			}
+			filled = append(filled, fmt.Sprintf("toInt32(%s) AS %sBad", bad, tName))
+		case false:
+			filled = append(filled, fmt.Sprintf("CAST(%s AS %s) AS %s", fld.deflt, tapeTypes[fld.kind], tName),
+				fmt.Sprintf("toInt32(0) AS %sBad", tName))
+		}
+
+		count := fmt.Sprintf("toInt32(sum(%sBad))", tName)
+		if fld.name == "month" {
+			// duplicate and skipped months also fail
+			count = "toInt32(sum(tapeMonthBad) + (count() - uniqExact(tapeMonth)) + " +
+				"(dateDiff('month', min(tapeMonth), max(tapeMonth)) + 1 - uniqExact(tapeMonth)))"
+		}
+
+		qaNames = append(qaNames, fmt.Sprintf("'%s'", fld.name))
+		qaCounts = append(qaCounts, count)
+
+		switch fld.monthly {
+		case true:
+			monthlyNames = append(monthlyNames, fmt.Sprintf("'%s'", fld.name))
+
+			if fld.name == "month" {
+				monthly = append(monthly, "arraySort(groupArray(tapeMonth)) AS month")
+				continue
+			}
+
+			monthly = append(monthly, fmt.Sprintf("arraySort((x, dt) -> dt, groupArray(%s), groupArray(tapeMonth)) AS %s",
+				tName, fld.name))
+		case false:
+			if fld.name == "lnId" {
+				continue
+			}
+
+			fields = append(fields, fmt.Sprintf("argMin(%s, tapeMonth) AS %s", tName, fld.name))
+		}
+	}
+
+	fields = append(fields, monthly...)
+	fields = append(fields, "arrayMap(dt -> toInt32(dateDiff('month', fpDt, dt)), month) AS ageFpDt",
+		fmt.Sprintf("arrayFilter((f, n) -> n > 0, [%s], [%s]) AS field", strings.Join(qaNames, ", "),
+			strings.Join(qaCounts, ", ")),
+		fmt.Sprintf("arrayFilter(n -> n > 0, [%s]) AS cntFail", strings.Join(qaCounts, ", ")),
+		"toInt32(count()) AS nMonths",
+		fmt.Sprintf("arrayFilter((f, n) -> n = nMonths AND has([%s], f), field, cntFail) AS allFail",
+			strings.Join(monthlyNames, ", ")))
+
+	source := specs.tapeFlat()
+	if specs.tapeParquet() {
+		source = fmt.Sprintf("file('%s', Parquet)", specs["tapeFile"])
+	}
+
+	repl := map[string]string{
+		"rawFields":  strings.Join(raw, ",\n"),
+		"tapeFields": strings.Join(filled, ",\n"),
+		"fields":     strings.Join(fields, ",\n"),
+		"tape":       source,
+	}
+
+	return buildQuery(withTape, repl), nil
+}
+
+// loadTape loads a text tape as is into the tapeFlat table.  All the columns are strings.
+func loadTape(specs specsMap, conn *chutils.Connect) error {
+	rdr, e := tapeReader(specs.getVal("tapeFile", true), specs.tapeSeparator())
+	if e != nil {
+		return e
+	}
+	defer func() { _ = rdr.Close() }()
+
+	if e := rdr.TableSpec().Create(conn, specs.tapeFlat()); e != nil {
+		return e
+	}
+
+	wtr := s.NewWriter(specs.tapeFlat(), conn)
+	defer func() { _ = wtr.Close() }()
+
+	return chutils.Export(rdr, wtr, tapeBatch, false)
+}
+
+// buildTape loads the loan tape into mtgDb and reports the loans that fail QA.  The table is keyed on lnId.
+func buildTape(ctx context.Context, specs specsMap, conn *chutils.Connect, log *runLog) error {
+	if !specs.tapeParquet() {
+		if e := loadTape(specs, conn); e != nil {
+			return e
+		}
+	}
+
+	qry, e := tapeQuery(specs)
+	if e != nil {
+		return e
+	}
+
+	rdr := s.NewReader(qry, conn)
+	rdr.Name = specs.getVal("mtgDb", true)
+
+	if e := rdr.Init("lnId", chutils.MergeTree); e != nil {
+		return e
+	}
+
+	if e := rdr.TableSpec().Nest("monthly", "month", "ageFpDt"); e != nil {
+		return e
+	}
+
+	if e := rdr.TableSpec().Nest("qa", "field", "cntFail"); e != nil {
+		return e
+	}
+
+	if e := rdr.TableSpec().Create(conn, rdr.Name); e != nil {
+		return e
+	}
+
+	if e := stopPass(ctx, conn, log, specs.tapeTables()...); e != nil {
+		return e
+	}
+
+	if e := rdr.Insert(); e != nil {
+		return e
+	}
+
+	return tapeQA(specs, conn, log)
+}
+
+// tapeQA logs the number of loans and loan-months in mtgDb and the number of loans that fail QA for each field.
+func tapeQA(specs specsMap, conn *chutils.Connect, log *runLog) error {
+	table := specs.getVal("mtgDb", true)
+
+	var loans, months uint64
+	qry := fmt.Sprintf("SELECT count(), sum(length(monthly.month)) FROM %s", table)
+	if e := conn.QueryRow(qry).Scan(&loans, &months); e != nil {
+		return e
+	}
+
+	rows, e := conn.Query(fmt.Sprintf("SELECT qa.field, count() AS n FROM %s ARRAY JOIN qa GROUP BY qa.field ORDER BY n DESC",
+		table))
+	if e != nil {
+		return e
+	}
+	defer func() { _ = rows.Close() }()
+
+	report := &strings.Builder{}
+	_, _ = fmt.Fprintf(report, "loan tape %s: %d loans, %d loan-months", specs.getVal("tapeFile", true), loans, months)
+
+	for rows.Next() {
+		var (
+			field string
+			n     uint64
+		)
+
+		if e := rows.Scan(&field, &n); e != nil {
+			return e
+		}
+
+		_, _ = fmt.Fprintf(report, "\n  %-10s fails QA for %d loans (%0.1f%%)", field, n, 100*float64(n)/float64(loans))
+	}
+
+	if e := rows.Err(); e != nil {
+		return e
+	}
+
+	log.info("tape", report.String(), true)
+
+	return nil
+}
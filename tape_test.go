@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// requiredMap maps the fields of mtgDb that have no default
+const requiredMap = "lnId=LOAN_ID, fpDt=FPD, term=TERM, rate=RATE, ltv=LTV, fico=FICO, state=ST, zip3=ZIP3, " +
+	"propVal=VAL, month=PERIOD, upb=UPB, dq=DQ"
+
+func TestTapeMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		tapeMap string
+		extra   map[string]string // mapped in addition to the required fields
+		wantErr bool
+	}{
+		{name: "required", tapeMap: requiredMap},
+		{name: "optional", tapeMap: requiredMap + ", dti=DTI, servicer=SERVICER_NAME",
+			extra: map[string]string{"dti": "DTI", "servicer": "SERVICER_NAME"}},
+		{name: "missing required", tapeMap: strings.Replace(requiredMap, "fico=FICO, ", "", 1), wantErr: true},
+		{name: "unknown field", tapeMap: requiredMap + ", score=SCORE", wantErr: true},
+		{name: "twice", tapeMap: requiredMap + ", fico=FICO2", wantErr: true},
+		{name: "no column", tapeMap: requiredMap + ", dti", wantErr: true},
+		{name: "empty column", tapeMap: requiredMap + ", dti=", wantErr: true},
+		{name: "illegal column", tapeMap: requiredMap + ", dti=2DTI", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := specsMap{"tapeMap": tt.tapeMap}.tapeMap()
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("tapeMap() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			want := map[string]string{"lnId": "LOAN_ID", "fpDt": "FPD", "term": "TERM", "rate": "RATE", "ltv": "LTV",
+				"fico": "FICO", "state": "ST", "zip3": "ZIP3", "propVal": "VAL", "month": "PERIOD", "upb": "UPB", "dq": "DQ"}
+			for k, v := range tt.extra {
+				want[k] = v
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("tapeMap() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTapeQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		tapeFile string
+		tapeMap  string
+		has      []string
+		hasNot   []string
+	}{
+		{
+			name:     "csv",
+			tapeFile: "loans.csv",
+			tapeMap:  requiredMap,
+			has: []string{
+				"tmp.loansFlat",
+				"toInt32OrNull(toString(t.FICO)) AS rawFico",
+				"ifNull(rawFico, CAST(0 AS Int32)) AS tapeFico",
+				"toInt32(ifNull(isNull(rawFico) OR NOT (rawFico BETWEEN 300 AND 850), 1)) AS tapeFicoBad",
+				"CAST(0 AS Float64) AS tapeDti",
+				"toInt32(0) AS tapeDtiBad",
+				"CAST(tapeLtv AS Float64) AS tapeCltv",
+				"argMin(tapeFico, tapeMonth) AS fico",
+				"arraySort(groupArray(tapeMonth)) AS month",
+				"tapeLnId AS lnId",
+			},
+			hasNot: []string{"Parquet", "AS rawDti"},
+		},
+		{
+			name:     "parquet",
+			tapeFile: "/data/loans.parquet",
+			tapeMap:  requiredMap + ", dti=DTI",
+			has: []string{
+				"file('/data/loans.parquet', Parquet)",
+				"toFloat64OrNull(toString(t.DTI)) AS rawDti",
+				"ifNull(rawDti, CAST(0 AS Float64)) AS tapeDti",
+				"toInt32(ifNull(isNotNull(rawDti) AND NOT (rawDti >= 0 AND rawDti <= 100), 1)) AS tapeDtiBad",
+			},
+			hasNot: []string{"loansFlat", "<tape>", "<rawFields>", "<tapeFields>", "<fields>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs := specsMap{"tapeFile": tt.tapeFile, "tapeMap": tt.tapeMap, "mtgDb": "tmp.loans"}
+
+			qry, e := tapeQuery(specs)
+			if e != nil {
+				t.Fatalf("tapeQuery() error = %v", e)
+			}
+
+			for _, s := range tt.has {
+				if !strings.Contains(qry, s) {
+					t.Errorf("query doesn't have %q", s)
+				}
+			}
+
+			for _, s := range tt.hasNot {
+				if strings.Contains(qry, s) {
+					t.Errorf("query has %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTape(t *testing.T) {
+	dir := t.TempDir()
+	header := "LOAN_ID,FPD,TERM,RATE,LTV,FICO,ST,ZIP3,VAL,PERIOD,UPB,DQ\n"
+	if e := os.WriteFile(filepath.Join(dir, "loans.csv"), []byte(header), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	tests := []struct {
+		name    string
+		specs   specsMap
+		wantKey string
+	}{
+		{name: "ok", specs: specsMap{"tapeMap": requiredMap, "mtgDb": "tmp.loans"}},
+		{name: "no tapeMap", specs: specsMap{"mtgDb": "tmp.loans"}, wantKey: "tapeFile"},
+		{name: "no mtgDb", specs: specsMap{"tapeMap": requiredMap}, wantKey: "tapeFile"},
+		{name: "bad tapeMap", specs: specsMap{"tapeMap": "lnId=LOAN_ID", "mtgDb": "tmp.loans"}, wantKey: "tapeMap"},
+		{name: "not in header", specs: specsMap{"tapeMap": requiredMap + ", dti=DTI", "mtgDb": "tmp.loans"},
+			wantKey: "tapeMap"},
+		{name: "parquet not read", specs: specsMap{"tapeMap": requiredMap + ", dti=DTI", "mtgDb": "tmp.loans",
+			"tapeFile": filepath.Join(dir, "loans.parquet")}},
+		{name: "no file", specs: specsMap{"tapeMap": requiredMap, "mtgDb": "tmp.loans",
+			"tapeFile": filepath.Join(dir, "none.csv")}, wantKey: "tapeFile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := tt.specs["tapeFile"]; !ok {
+				tt.specs["tapeFile"] = filepath.Join(dir, "loans.csv")
+			}
+
+			key, e := tt.specs.checkTape()
+			if (e != nil) != (tt.wantKey != "") || key != tt.wantKey {
+				t.Errorf("checkTape() = %s, %v, want key %q", key, e, tt.wantKey)
+			}
+		})
+	}
+}